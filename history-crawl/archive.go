@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lyineee/go-learn/history-crawl/blob"
+)
+
+//archive mode, what is kept of every crawled page
+const (
+	ArchiveOff   = ""
+	ArchiveRaw   = "raw"   //page as crawled, decoded to utf-8
+	ArchivePosts = "posts" //posts of the page in json, raw page if extractor has no PostExtractor
+)
+
+//one floor of a thread
+type Post struct {
+	Floor   int       `json:"floor"`
+	Author  string    `json:"author,omitempty"`
+	Time    time.Time `json:"time,omitempty"`
+	Content string    `json:"content"`
+}
+
+//optional interface of Extractor
+type PostExtractor interface {
+	Posts(page string) ([]Post, error)
+}
+
+type ArchiveConfig struct {
+	Mode    string        `mapstructure:"mode"`
+	Backend string        `mapstructure:"backend"` //local or s3
+	Dir     string        `mapstructure:"dir"`     //directory of local backend
+	S3      blob.S3Config `mapstructure:"s3"`
+}
+
+type archiver struct {
+	mode  string
+	store blob.Store
+}
+
+//nil if archive is off
+func newArchiver(ctx context.Context, config ArchiveConfig) (*archiver, error) {
+	var store blob.Store
+	var err error
+	switch config.Mode {
+	case ArchiveOff:
+		return nil, nil
+	case ArchiveRaw, ArchivePosts:
+	default:
+		return nil, fmt.Errorf("unknown archive mode %q", config.Mode)
+	}
+	switch config.Backend {
+	case "local":
+		store, err = blob.NewLocal(config.Dir)
+	case "s3":
+		store, err = blob.NewS3(ctx, config.S3)
+	default:
+		return nil, fmt.Errorf("unknown archive backend %q", config.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &archiver{mode: config.Mode, store: store}, nil
+}
+
+//save crawled page, return content key of the blob
+func (a *archiver) archive(ctx context.Context, extractor Extractor, page string) (string, error) {
+	data := []byte(page)
+	contentType := http.DetectContentType(data)
+	if postExtractor, ok := extractor.(PostExtractor); ok && a.mode == ArchivePosts {
+		posts, err := postExtractor.Posts(page)
+		if err == nil && len(posts) != 0 {
+			data, err = json.Marshal(posts)
+			if err != nil {
+				return "", err
+			}
+			contentType = "application/json"
+		} else {
+			logger.Warnw("extract posts fail, archive raw page", "type", extractor.Type(), "error", err)
+		}
+	}
+	return blob.PutContent(ctx, a.store, data, contentType)
+}
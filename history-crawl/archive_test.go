@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lyineee/go-learn/history-crawl/blob"
+	"github.com/lyineee/go-learn/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosts(t *testing.T) {
+	ast := assert.New(t)
+	posts, err := nga{}.Posts(fixture(t, "nga.html"))
+	ast.Nil(err)
+	ast.Equal([]Post{
+		{Floor: 0, Author: "魔物使いの月", Time: time.Date(2022, 1, 3, 21, 14, 0, 0, chinaTime), Content: "正文"},
+		{Floor: 1, Author: "路人甲", Time: time.Date(2022, 2, 15, 20, 1, 0, 0, chinaTime), Content: "更新了"},
+	}, posts)
+
+	posts, err = v2ex{}.Posts(fixture(t, "v2ex.html"))
+	ast.Nil(err)
+	if ast.Len(posts, 2) {
+		ast.Equal(2, posts[1].Floor)
+		ast.Equal("消费者组自己写个命令行就好了 & 也不难", posts[1].Content)
+		ast.True(time.Date(2022, 2, 15, 12, 31, 9, 0, chinaTime).Equal(posts[1].Time))
+	}
+}
+
+func TestArchiver(t *testing.T) {
+	logger = utils.GetLogger().Sugar()
+	ast := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	a, err := newArchiver(ctx, ArchiveConfig{Mode: ArchivePosts, Backend: "local", Dir: dir})
+	ast.Nil(err)
+
+	page := fixture(t, "nga.html")
+	key, err := a.archive(ctx, nga{}, page)
+	ast.Nil(err)
+	data, err := a.store.Get(ctx, key)
+	ast.Nil(err)
+	posts := []Post{}
+	ast.Nil(json.Unmarshal(data, &posts))
+	ast.Len(posts, 2)
+
+	page = fixture(t, "tieba.html")
+	key, err = a.archive(ctx, tieba{}, page) //no PostExtractor
+	ast.Nil(err)
+	ast.Equal(blob.Key([]byte(page)), key)
+
+	a, err = newArchiver(ctx, ArchiveConfig{})
+	ast.Nil(err)
+	ast.Nil(a)
+	_, err = newArchiver(ctx, ArchiveConfig{Mode: ArchiveRaw, Backend: "ftp"})
+	ast.NotNil(err)
+}
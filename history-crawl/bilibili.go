@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
+)
+
+func init() {
+	Register(bilibili{})
+}
+
+//dynamic and video, crawled from web api instead of the page rendered by javascript.
+//total page is the page count of comments
+type bilibili struct{}
+
+const bilibiliCommentPageSize = 20
+
+var (
+	bilibiliDynamicPath = regexp.MustCompile(`^/(?:opus/)?(\d+)/?$`)
+	bilibiliVideoPath   = regexp.MustCompile(`^/video/(BV\w+|av\d+)/?$`)
+)
+
+type bilibiliResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		//video
+		Title string `json:"title"`
+		Owner struct {
+			Name string `json:"name"`
+		} `json:"owner"`
+		Stat struct {
+			Reply int `json:"reply"`
+		} `json:"stat"`
+		//dynamic
+		Item *struct {
+			Modules struct {
+				Author struct {
+					Name string `json:"name"`
+				} `json:"module_author"`
+				Dynamic struct {
+					Desc *struct {
+						Text string `json:"text"`
+					} `json:"desc"`
+				} `json:"module_dynamic"`
+				Stat struct {
+					Comment struct {
+						Count int `json:"count"`
+					} `json:"comment"`
+				} `json:"module_stat"`
+			} `json:"modules"`
+		} `json:"item"`
+	} `json:"data"`
+}
+
+func (bilibili) Type() string {
+	return "bilibili"
+}
+
+func (bilibili) Match(u *url.URL) bool {
+	switch u.Hostname() {
+	case "t.bilibili.com":
+		return bilibiliDynamicPath.MatchString(u.Path)
+	case "www.bilibili.com", "m.bilibili.com":
+		return strings.HasPrefix(u.Path, "/opus/") && bilibiliDynamicPath.MatchString(u.Path) || bilibiliVideoPath.MatchString(u.Path)
+	}
+	return false
+}
+
+//api url of dynamic or video
+func bilibiliAPI(crawlUrl string) (string, error) {
+	u, err := url.Parse(crawlUrl)
+	if err != nil {
+		return "", err
+	}
+	if match := bilibiliVideoPath.FindStringSubmatch(u.Path); len(match) == 2 {
+		if strings.HasPrefix(match[1], "av") {
+			return "https://api.bilibili.com/x/web-interface/view?aid=" + strings.TrimPrefix(match[1], "av"), nil
+		}
+		return "https://api.bilibili.com/x/web-interface/view?bvid=" + match[1], nil
+	}
+	if match := bilibiliDynamicPath.FindStringSubmatch(u.Path); len(match) == 2 {
+		return "https://api.bilibili.com/x/polymer/web-dynamic/v1/detail?id=" + match[1], nil
+	}
+	return "", fmt.Errorf("not a bilibili dynamic or video url: %s", crawlUrl)
+}
+
+func (bilibili) Request(ctx context.Context, client *crawlclient.Client, crawlUrl string) (*http.Request, error) {
+	api, err := bilibiliAPI(crawlUrl)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", api, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Referer", "https://www.bilibili.com/")
+	return req, nil
+}
+
+func (bilibili) Parse(page string) (info postInformation, err error) {
+	resp := bilibiliResponse{}
+	if err = json.Unmarshal([]byte(page), &resp); err != nil {
+		return info, fmt.Errorf("unmarshal bilibili response: %w", err)
+	}
+	switch resp.Code {
+	case 0:
+	case -404: //video or dynamic not found
+		return info, fmt.Errorf("%w: %s", ErrThreadDeleted, resp.Message)
+	case -101:
+		return info, fmt.Errorf("%w: %s", ErrLoginRequired, resp.Message)
+	default:
+		return info, fmt.Errorf("bilibili api error %d: %s", resp.Code, resp.Message)
+	}
+	comments := resp.Data.Stat.Reply
+	if item := resp.Data.Item; item != nil {
+		info.Title = item.Modules.Author.Name + "的动态"
+		if desc := item.Modules.Dynamic.Desc; desc != nil && desc.Text != "" {
+			info.Title = dynamicTitle(desc.Text)
+		}
+		comments = item.Modules.Stat.Comment.Count
+		info.Author = item.Modules.Author.Name
+	} else {
+		info.Title = resp.Data.Title
+		info.Author = resp.Data.Owner.Name
+	}
+	info.ReplyCount = comments
+	if info.Title == "" {
+		return info, missingField("bilibili", "title")
+	}
+	info.TotalPage = (comments + bilibiliCommentPageSize - 1) / bilibiliCommentPageSize
+	if info.TotalPage == 0 {
+		info.TotalPage = 1
+	}
+	return info, nil
+}
+
+//first line of dynamic text, at most 30 characters
+func dynamicTitle(text string) string {
+	title := []rune(strings.TrimSpace(strings.SplitN(strings.TrimSpace(text), "\n", 2)[0]))
+	if len(title) > 30 {
+		return string(title[:30]) + "…"
+	}
+	return string(title)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBilibiliExtractor(t *testing.T) {
+	ast := assert.New(t)
+	info, err := bilibili{}.Parse(fixture(t, "bilibili_dynamic.json"))
+	ast.Equal(nil, err)
+	ast.Equal(postInformation{
+		Title:      "【连载】魔物训使 第三十五话更新了！",
+		TotalPage:  18,
+		ReplyCount: 345,
+		Author:     "某科学的UP主",
+	}, info)
+
+	info, err = bilibili{}.Parse(fixture(t, "bilibili_video.json"))
+	ast.Equal(nil, err)
+	ast.Equal(postInformation{
+		Title:      "【官方 MV】Never Gonna Give You Up - Rick Astley",
+		TotalPage:  6994,
+		ReplyCount: 139876,
+		Author:     "索尼音乐中国",
+	}, info)
+
+	_, err = bilibili{}.Parse(fixture(t, "bilibili_error.json"))
+	ast.NotNil(err)
+}
+
+func TestBilibiliAPI(t *testing.T) {
+	ast := assert.New(t)
+	cases := map[string]string{
+		"https://t.bilibili.com/643451139714449427":        "https://api.bilibili.com/x/polymer/web-dynamic/v1/detail?id=643451139714449427",
+		"https://www.bilibili.com/opus/643451139714449427": "https://api.bilibili.com/x/polymer/web-dynamic/v1/detail?id=643451139714449427",
+		"https://www.bilibili.com/video/BV1GJ411x7h7?p=1":  "https://api.bilibili.com/x/web-interface/view?bvid=BV1GJ411x7h7",
+		"https://www.bilibili.com/video/av80433022":        "https://api.bilibili.com/x/web-interface/view?aid=80433022",
+	}
+	for crawlUrl, api := range cases {
+		got, err := bilibiliAPI(crawlUrl)
+		ast.Nil(err)
+		ast.Equal(api, got)
+	}
+	_, err := bilibiliAPI("https://www.bilibili.com/read/cv123")
+	ast.NotNil(err)
+}
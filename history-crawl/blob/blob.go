@@ -0,0 +1,38 @@
+//content addressed storage of archived pages
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	//ErrNotFound if key is not stored
+	Get(ctx context.Context, key string) ([]byte, error)
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+//key by sha256 of content, e.g. sha256/ab/ab12...
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return "sha256/" + hash[:2] + "/" + hash
+}
+
+//store data under its content key, same content is stored once
+func PutContent(ctx context.Context, store Store, data []byte, contentType string) (string, error) {
+	key := Key(data)
+	exists, err := store.Exists(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return key, nil
+	}
+	return key, store.Put(ctx, key, data, contentType)
+}
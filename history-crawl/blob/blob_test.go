@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store Store) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	data := []byte("<title>魔物训使</title>")
+
+	key, err := PutContent(ctx, store, data, "text/html; charset=utf-8")
+	ast.Nil(err)
+	ast.Equal(Key(data), key)
+	ast.Regexp(`^sha256/[0-9a-f]{2}/[0-9a-f]{64}$`, key)
+	exists, err := store.Exists(ctx, key)
+	ast.Nil(err)
+	ast.True(exists)
+	got, err := store.Get(ctx, key)
+	ast.Nil(err)
+	ast.Equal(data, got)
+	again, err := PutContent(ctx, store, data, "text/html; charset=utf-8")
+	ast.Nil(err)
+	ast.Equal(key, again)
+
+	missing := Key([]byte("missing"))
+	exists, err = store.Exists(ctx, missing)
+	ast.Nil(err)
+	ast.False(exists)
+	_, err = store.Get(ctx, missing)
+	ast.ErrorIs(err, ErrNotFound)
+}
+
+func TestLocal(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+	assert.NotNil(t, store.Put(context.Background(), "../escape", []byte("x"), ""))
+}
+
+//run against a local MinIO by setting S3_TEST_ENDPOINT, e.g. localhost:9000 with minioadmin
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	store, err := NewS3(context.Background(), S3Config{
+		Endpoint:  endpoint,
+		Bucket:    "history-archive-test",
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+		Prefix:    "test/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
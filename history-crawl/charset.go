@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+//only the head of page is searched for <meta charset>
+const metaSniffLen = 4096
+
+var regMetaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([\w-]+)`)
+
+//tried in order when charset is not declared and page is not utf-8
+var fallbackEncodings = []struct {
+	name     string
+	encoding encoding.Encoding
+}{
+	{"gbk", simplifiedchinese.GBK},
+	{"gb18030", simplifiedchinese.GB18030},
+	{"big5", traditionalchinese.Big5},
+}
+
+var errUnknownCharset = errors.New("can not detect page charset")
+
+//decode page to utf-8, return the charset used.
+//valid utf-8 is kept as is even if another charset is declared, since a page in
+//a multibyte charset like gbk is almost never valid utf-8
+func decodePage(body []byte, contentType string) (string, string, error) {
+	if e, name := bomEncoding(body); e != nil {
+		return decodeWith(body, e, name)
+	}
+	if utf8.Valid(body) {
+		return string(body), "utf-8", nil
+	}
+	for _, name := range []string{headerCharset(contentType), metaCharset(body)} {
+		if name == "" {
+			continue
+		}
+		e, err := htmlindex.Get(name)
+		if err != nil { //unknown declared charset is ignored
+			continue
+		}
+		canonical, _ := htmlindex.Name(e)
+		return decodeWith(body, e, canonical)
+	}
+	for _, fallback := range fallbackEncodings {
+		page, err := fallback.encoding.NewDecoder().Bytes(body)
+		if err == nil && !bytes.ContainsRune(page, utf8.RuneError) {
+			return string(page), fallback.name, nil
+		}
+	}
+	return string(body), "", errUnknownCharset
+}
+
+func decodeWith(body []byte, e encoding.Encoding, name string) (string, string, error) {
+	page, err := e.NewDecoder().Bytes(body)
+	if err != nil {
+		return string(body), name, err
+	}
+	return string(page), name, nil
+}
+
+func bomEncoding(body []byte) (encoding.Encoding, string) {
+	switch {
+	case bytes.HasPrefix(body, []byte{0xef, 0xbb, 0xbf}):
+		return unicode.UTF8BOM, "utf-8"
+	case bytes.HasPrefix(body, []byte{0xfe, 0xff}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), "utf-16be"
+	case bytes.HasPrefix(body, []byte{0xff, 0xfe}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "utf-16le"
+	}
+	return nil, ""
+}
+
+func headerCharset(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(params["charset"])
+}
+
+func metaCharset(body []byte) string {
+	if len(body) > metaSniffLen {
+		body = body[:metaSniffLen]
+	}
+	match := regMetaCharset.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
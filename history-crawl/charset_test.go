@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func TestDecodePage(t *testing.T) {
+	ast := assert.New(t)
+	text := "<title>魔物训使</title>"
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String(text)
+	big5, _ := traditionalchinese.Big5.NewEncoder().String("<title>魔物訓使</title>")
+
+	cases := []struct {
+		name        string
+		body        string
+		contentType string
+		charset     string
+		page        string
+	}{
+		{"utf-8", text, "", "utf-8", text},
+		{"utf-8 declared gbk", "<meta charset='gbk'>" + text, "text/html; charset=GBK", "utf-8", "<meta charset='gbk'>" + text},
+		{"bom", "\xef\xbb\xbf" + text, "", "utf-8", text},
+		{"header", gbk, "text/html; charset=gb2312", "gbk", text},
+		{"meta", "<meta http-equiv='Content-Type' content='text/html; charset=GBK'>" + gbk, "text/html", "gbk", "<meta http-equiv='Content-Type' content='text/html; charset=GBK'>" + text},
+		{"unknown declared", gbk, "text/html; charset=x-unknown", "gbk", text},
+		{"fallback gbk", gbk, "", "gbk", text},
+		{"declared big5", big5, "text/html; charset=big5", "big5", "<title>魔物訓使</title>"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			page, charset, err := decodePage([]byte(c.body), c.contentType)
+			assert.Nil(t, err)
+			assert.Equal(t, c.charset, charset)
+			assert.Equal(t, c.page, page)
+		})
+	}
+
+	_, _, err := decodePage([]byte{0x81, 0x20, 0xff, 0xff}, "")
+	ast.ErrorIs(err, errUnknownCharset)
+}
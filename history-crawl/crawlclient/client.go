@@ -0,0 +1,269 @@
+//http client shared by extractors, with per host rate limit, retry and cookie jar
+package crawlclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type Config struct {
+	Timeout    time.Duration      //timeout of one attempt, the request context still applies
+	MaxRetries int                //retry on network error, 429 and 5xx
+	MinBackoff time.Duration      //first retry wait, doubled each retry with jitter
+	MaxBackoff time.Duration      //max wait between retries, also caps Retry-After
+	Rate       float64            //requests per second of one host
+	Burst      int                //bucket size of one host
+	HostRates  map[string]float64 //override Rate of host
+	UserAgent  string             //set if request has no User-Agent
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Timeout:    10 * time.Second,
+		MaxRetries: 3,
+		MinBackoff: 500 * time.Millisecond,
+		MaxBackoff: 30 * time.Second,
+		Rate:       1,
+		Burst:      1,
+		UserAgent:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.102 Safari/537.36",
+	}
+}
+
+type Client struct {
+	client   *http.Client
+	config   Config
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func New(config Config) *Client {
+	jar, _ := cookiejar.New(nil) //never return error
+	return &Client{
+		client:   &http.Client{Jar: &expiryJar{CookieJar: jar, expires: map[string]time.Time{}}},
+		config:   config,
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+//cookies are kept for later requests to the same host
+func (c *Client) Jar() http.CookieJar {
+	return c.client.Jar
+}
+
+//expiry of a cookie of url host, zero for session cookie or cookie not in jar
+func (c *Client) CookieExpires(u *url.URL, name string) time.Time {
+	jar := c.client.Jar.(*expiryJar)
+	jar.mu.Lock()
+	defer jar.mu.Unlock()
+	return jar.expires[u.Hostname()+";"+name]
+}
+
+//remove cookies of url from jar, cookies set for a parent domain are not removed
+func (c *Client) DeleteCookies(u *url.URL, names ...string) {
+	cookies := make([]*http.Cookie, 0, 2*len(names))
+	for _, name := range names {
+		cookies = append(cookies,
+			&http.Cookie{Name: name, Path: "/", MaxAge: -1},
+			&http.Cookie{Name: name, Path: "/", Domain: u.Hostname(), MaxAge: -1},
+		)
+	}
+	c.client.Jar.SetCookies(u, cookies)
+}
+
+//cookie jar keeping expiry of cookies by host and name, which is not returned by http.CookieJar
+type expiryJar struct {
+	http.CookieJar
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func (jar *expiryJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	now := time.Now()
+	jar.mu.Lock()
+	for _, cookie := range cookies {
+		key := u.Hostname() + ";" + cookie.Name
+		switch {
+		case cookie.MaxAge > 0:
+			jar.expires[key] = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		case cookie.MaxAge == 0 && !cookie.Expires.IsZero():
+			jar.expires[key] = cookie.Expires
+		default:
+			delete(jar.expires, key)
+		}
+	}
+	jar.mu.Unlock()
+	jar.CookieJar.SetCookies(u, cookies)
+}
+
+func (c *Client) limiter(host string) *rate.Limiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	limiter, ok := c.limiters[host]
+	if !ok {
+		r, ok := c.config.HostRates[host]
+		if !ok {
+			r = c.config.Rate
+		}
+		limit := rate.Inf
+		if r > 0 {
+			limit = rate.Limit(r)
+		}
+		burst := c.config.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(limit, burst)
+		c.limiters[host] = limiter
+	}
+	return limiter
+}
+
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+//send request with rate limit and retry, request with body is retried only if GetBody is set.
+//the last response is returned if all retries fail with a retryable status
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if req.Header.Get("User-Agent") == "" && c.config.UserAgent != "" {
+		req.Header.Set("User-Agent", c.config.UserAgent)
+	}
+	limiter := c.limiter(req.URL.Hostname())
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req)
+		last := attempt >= c.config.MaxRetries || (req.Body != nil && req.GetBody == nil)
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+		if last || ctx.Err() != nil {
+			return resp, err
+		}
+		wait := c.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				wait = after
+				if c.config.MaxBackoff > 0 && wait > c.config.MaxBackoff {
+					wait = c.config.MaxBackoff
+				}
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+//one attempt with Timeout, the body is readable until closed
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.config.Timeout <= 0 {
+		return c.client.Do(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), c.config.Timeout)
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+//MinBackoff * 2^attempt capped by MaxBackoff, randomized in [wait/2, wait]
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.config.MinBackoff
+	for i := 0; i < attempt && (c.config.MaxBackoff <= 0 || wait < c.config.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if c.config.MaxBackoff > 0 && wait > c.config.MaxBackoff {
+		wait = c.config.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+//Retry-After in seconds or http date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+//error of a response with non 2xx status
+type StatusError struct {
+	Url    string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s return with status %d", e.Url, e.Status)
+}
+
+//return *StatusError if status is not 2xx
+func CheckStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &StatusError{Url: resp.Request.URL.String(), Status: resp.StatusCode}
+}
@@ -0,0 +1,152 @@
+package crawlclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() Config {
+	config := DefaultConfig()
+	config.MinBackoff = time.Millisecond
+	config.MaxBackoff = 10 * time.Millisecond
+	config.Rate = 0
+	return config
+}
+
+func TestRetry(t *testing.T) {
+	ast := assert.New(t)
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&count, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			ast.NotEmpty(r.Header.Get("User-Agent"))
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	resp, err := New(testConfig()).Get(context.Background(), server.URL)
+	ast.Nil(err)
+	defer resp.Body.Close()
+	ast.Equal(http.StatusOK, resp.StatusCode)
+	ast.Equal(int32(3), count)
+}
+
+func TestRetryGiveUp(t *testing.T) {
+	ast := assert.New(t)
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	config := testConfig()
+	config.MaxRetries = 2
+	resp, err := New(config).Get(context.Background(), server.URL)
+	ast.Nil(err)
+	defer resp.Body.Close()
+	ast.Equal(http.StatusBadGateway, resp.StatusCode)
+	ast.Equal(int32(3), count)
+	var statusErr *StatusError
+	ast.ErrorAs(CheckStatus(resp), &statusErr)
+	ast.Equal(http.StatusBadGateway, statusErr.Status)
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	ast := assert.New(t)
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	resp, err := New(testConfig()).Get(context.Background(), server.URL)
+	ast.Nil(err)
+	resp.Body.Close()
+	ast.Equal(int32(1), count)
+}
+
+func TestCookieJar(t *testing.T) {
+	ast := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			return
+		}
+		cookie, err := r.Cookie("session")
+		ast.Nil(err)
+		ast.Equal("abc", cookie.Value)
+	}))
+	defer server.Close()
+
+	client := New(testConfig())
+	resp, err := client.Get(context.Background(), server.URL+"/login")
+	ast.Nil(err)
+	resp.Body.Close()
+	resp, err = client.Get(context.Background(), server.URL+"/read")
+	ast.Nil(err)
+	resp.Body.Close()
+}
+
+func TestCookieExpires(t *testing.T) {
+	ast := assert.New(t)
+	client := New(testConfig())
+	u, _ := url.Parse("https://bbs.nga.cn/read.php?tid=1")
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	client.Jar().SetCookies(u, []*http.Cookie{
+		{Name: "guestJs", Value: "1", Path: "/", Expires: expires},
+		{Name: "lastvisit", Value: "1", Path: "/", MaxAge: 60},
+		{Name: "uid", Value: "1", Path: "/"},
+	})
+	ast.Equal(expires, client.CookieExpires(u, "guestJs"))
+	ast.WithinDuration(time.Now().Add(time.Minute), client.CookieExpires(u, "lastvisit"), time.Second)
+	ast.True(client.CookieExpires(u, "uid").IsZero())
+	client.DeleteCookies(u, "guestJs")
+	ast.True(client.CookieExpires(u, "guestJs").IsZero())
+}
+
+func TestHostRate(t *testing.T) {
+	ast := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	config := testConfig()
+	config.HostRates = map[string]float64{"127.0.0.1": 20}
+	client := New(config)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(context.Background(), server.URL)
+		ast.Nil(err)
+		resp.Body.Close()
+	}
+	ast.GreaterOrEqual(time.Since(start), 90*time.Millisecond) //burst 1, 2 waits of 50ms
+}
+
+func TestRetryAfter(t *testing.T) {
+	ast := assert.New(t)
+	now := time.Date(2022, 2, 20, 12, 0, 0, 0, time.UTC)
+	wait, ok := retryAfter("120", now)
+	ast.True(ok)
+	ast.Equal(2*time.Minute, wait)
+	wait, ok = retryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	ast.True(ok)
+	ast.Equal(time.Minute, wait)
+	_, ok = retryAfter("soon", now)
+	ast.False(ok)
+	_, ok = retryAfter("", now)
+	ast.False(ok)
+}
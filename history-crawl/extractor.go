@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
+)
+
+//time without zone in crawled pages
+var chinaTime = time.FixedZone("CST", 8*60*60)
+
+//site support of history-crawl, register it in init of its own file
+type Extractor interface {
+	//history type handled, e.g. "nga"
+	Type() string
+	//used when history type is empty or unknown
+	Match(u *url.URL) bool
+	//prepare request of the page, e.g. cookies
+	Request(ctx context.Context, client *crawlclient.Client, crawlUrl string) (*http.Request, error)
+	//parse crawled page, decoded to utf-8.
+	//return *MissingFieldError if a required field is not found,
+	//ErrThreadDeleted for deleted thread and ErrLoginRequired if thread is visible to logged in user only
+	Parse(page string) (postInformation, error)
+}
+
+//optional interface of Extractor, used instead of Parse if the crawl url is needed to parse the page
+type URLParser interface {
+	ParseURL(crawlUrl, page string) (postInformation, error)
+}
+
+func parsePage(extractor Extractor, crawlUrl, page string) (postInformation, error) {
+	if parser, ok := extractor.(URLParser); ok {
+		return parser.ParseURL(crawlUrl, page)
+	}
+	return extractor.Parse(page)
+}
+
+var (
+	extractors     = map[string]Extractor{}
+	extractorOrder []Extractor //match in register order
+)
+
+func Register(extractor Extractor) {
+	if _, ok := extractors[extractor.Type()]; ok {
+		panic(fmt.Sprintf("extractor %s registered twice", extractor.Type()))
+	}
+	extractors[extractor.Type()] = extractor
+	extractorOrder = append(extractorOrder, extractor)
+}
+
+//extractor by history type, or the first one matching history url
+func lookupExtractor(history History) (Extractor, bool) {
+	if extractor, ok := extractors[history.Type]; ok {
+		return extractor, true
+	}
+	u, err := url.Parse(history.Url)
+	if err != nil {
+		return nil, false
+	}
+	for _, extractor := range extractorOrder {
+		if extractor.Match(u) {
+			return extractor, true
+		}
+	}
+	return nil, false
+}
+
+//crawl history page and update title, total page and status, return crawled page and its http status
+func extract(ctx context.Context, client *crawlclient.Client, extractor Extractor, history *History) (page string, status int, err error) {
+	page, status, err = crawlPage(ctx, client, history.Url, extractor)
+	if err != nil {
+		return page, status, err
+	}
+	info, err := parsePage(extractor, history.Url, page)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("get %s info fail", extractor.Type()), "crawl page", page, "history", history, "error", err)
+		return page, status, err
+	}
+	history.Title = info.Title
+	history.TotalPage = info.TotalPage
+	history.Status = crawlStatus(info, status, nil)
+	//keep saved value if not found
+	if info.ReplyCount != 0 {
+		history.ReplyCount = info.ReplyCount
+	}
+	if info.Author != "" {
+		history.Author = info.Author
+	}
+	if !info.LastReplyAt.IsZero() {
+		history.LastReplyAt = info.LastReplyAt
+	}
+	return page, status, nil
+}
+
+func crawlPage(ctx context.Context, client *crawlclient.Client, crawlUrl string, extractor Extractor) (string, int, error) {
+	logger.Debugw("start crwaling page", "url", crawlUrl)
+	req, err := extractor.Request(ctx, client, crawlUrl)
+	if err != nil {
+		logger.Errorw("Error when process postReqeust function", "crawl_url", crawlUrl, "error", err)
+		return "", 0, err
+	}
+	logger.Debugw("get request", "cookies", req.Cookies())
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorw("Error when request crawl url", "crawl_url", crawlUrl, "error", err)
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logger.Errorw("Error read response body", "crawl_url", crawlUrl, "error", err)
+	}
+	//extractors always get utf-8
+	page, charset, err := decodePage(bytes, resp.Header.Get("Content-Type"))
+	if err != nil {
+		logger.Warnw("decode page error, parse as utf-8", "crawl_url", crawlUrl, "charset", charset, "error", err)
+	}
+	logger.Debugw("decode page", "crawl_url", crawlUrl, "charset", charset)
+	return page, resp.StatusCode, nil
+}
+
+//last submatch of re in text, empty if not found
+func lastSubmatch(re *regexp.Regexp, text string) string {
+	matches := re.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1][1]
+}
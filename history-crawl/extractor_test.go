@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//saved page in testdata, decoded as crawled page
+func fixture(t *testing.T, name string) string {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal("missing fixture", err)
+	}
+	page, _, err := decodePage(raw, "")
+	if err != nil {
+		t.Fatal("decode fixture", err)
+	}
+	return page
+}
+
+//saved pages in testdata/<type>[_<case>].html
+func TestExtractorFixtures(t *testing.T) {
+	nga := postInformation{
+		Title:       "[安科/安价] [原创] 我的女友是黄油女主这件事(心：女同竟在我身边) NGA玩家社区",
+		TotalPage:   82,
+		Author:      "魔物使いの月",
+		LastReplyAt: time.Date(2022, 2, 15, 20, 1, 0, 0, chinaTime),
+	}
+	ngaLocked := nga
+	ngaLocked.Locked = true
+	tieba := postInformation{Title: "【安科漫画】魔物训使", TotalPage: 35, ReplyCount: 1824, Author: "地底的月亮"}
+	tiebaLogin := tieba
+	tiebaLogin.TotalPage = 70 //not converted from page of guest
+	tiebaLocked := tieba
+	tiebaLocked.Locked = true
+	tiebaOnePage := tieba
+	tiebaOnePage.TotalPage = 1 //not 0 of a history never crawled
+	expected := map[string]postInformation{
+		"nga":            nga,
+		"nga_login":      nga,
+		"nga_locked":     ngaLocked,
+		"tieba":          tieba,
+		"tieba_login":    tiebaLogin,
+		"tieba_locked":   tiebaLocked,
+		"tieba_one_page": tiebaOnePage,
+	}
+	for name, info := range expected {
+		extractor := extractors[strings.Split(name, "_")[0]]
+		name, info := name, info
+		t.Run(name, func(t *testing.T) {
+			got, err := extractor.Parse(fixture(t, name+".html"))
+			assert.Nil(t, err)
+			assert.Equal(t, info, got)
+		})
+	}
+}
+
+//notice quoted in a reply is not the notice of the thread
+func TestExtractorQuotedNotice(t *testing.T) {
+	ast := assert.New(t)
+	quote := `<div class="d_post_content">` + tiebaDeletedText + tiebaLockedText + `</div>`
+	info, err := tiebaExtractor(strings.Replace(fixture(t, "tieba.html"), "<body>", "<body>"+quote, 1))
+	ast.Nil(err)
+	ast.False(info.Locked)
+	quote = `<span class="postcontent">` + ngaLockedText + `</span>`
+	info, err = ngaExtractor(strings.Replace(fixture(t, "nga.html"), "<body>", "<body>"+quote, 1))
+	ast.Nil(err)
+	ast.False(info.Locked)
+}
+
+func TestExtractorErrors(t *testing.T) {
+	ast := assert.New(t)
+	for _, name := range []string{"nga", "tieba"} {
+		_, err := extractors[name].Parse(fixture(t, name+"_deleted.html"))
+		ast.ErrorIs(err, ErrThreadDeleted, name)
+	}
+
+	var missing *MissingFieldError
+	_, err := tiebaExtractor(`<title>回复：【安科漫画】魔物训使_安科吧_百度贴吧</title>`)
+	if ast.ErrorAs(err, &missing) {
+		ast.Equal("total page", missing.Field)
+	}
+	_, err = tiebaExtractor(`<script>PageData.pager = {"cur_page":1,"total_page":70,"page_size":30};</script>`)
+	if ast.ErrorAs(err, &missing) {
+		ast.Equal("title", missing.Field)
+	}
+	_, err = ngaExtractor(`<title>NGA玩家社区</title>`)
+	if ast.ErrorAs(err, &missing) {
+		ast.Equal("total page", missing.Field)
+	}
+	_, err = v2ex{}.Parse(`<div class="cell">no title</div>`)
+	if ast.ErrorAs(err, &missing) {
+		ast.Equal("v2ex", missing.Type)
+	}
+}
+
+func TestLookupExtractor(t *testing.T) {
+	ast := assert.New(t)
+	cases := map[string]History{
+		"nga":      {Url: "https://bbs.nga.cn/read.php?tid=29824736&page=22"},
+		"tieba":    {Url: "https://tieba.baidu.com/p/7278674944?pn=2"},
+		"bilibili": {Url: "https://t.bilibili.com/643451139714449427"},
+		"zhihu":    {Url: "https://www.zhihu.com/question/19550225"},
+		"v2ex":     {Url: "https://www.v2ex.com/t/836492#reply50"},
+	}
+	for name, history := range cases {
+		extractor, ok := lookupExtractor(history)
+		if ast.True(ok, name) {
+			ast.Equal(name, extractor.Type())
+		}
+	}
+	extractor, ok := lookupExtractor(History{Type: "tieba", Url: "https://bbs.nga.cn/read.php?tid=1"})
+	ast.True(ok)
+	ast.Equal("tieba", extractor.Type()) //type first
+	_, ok = lookupExtractor(History{Url: "https://example.com/read.php"})
+	ast.False(ok)
+
+	u, _ := url.Parse("https://tieba.baidu.com/f?kw=test")
+	ast.False(tieba{}.Match(u))
+}
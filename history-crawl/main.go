@@ -1,35 +1,38 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
-	"regexp"
-	"strconv"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/lyineee/go-learn/utils/log"
 	_ "github.com/lyineee/go-learn/utils/remote"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/text/encoding/simplifiedchinese"
-	"golang.org/x/text/transform"
 
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
+	"github.com/lyineee/go-learn/history-crawl/snapshot"
 	rstream "github.com/lyineee/go-learn/redis-stream"
+	rsmessage "github.com/lyineee/go-learn/redis-stream/message"
 )
 
-type postRequestFunc func(client *http.Client, crawlUrl string) (*http.Request, error)
-
+//zero value of optional fields means not found in page
 type postInformation struct {
-	Title     string
-	TotalPage int
+	Title       string
+	TotalPage   int
+	ReplyCount  int
+	Author      string //original poster
+	LastReplyAt time.Time
+	Locked      bool //no new reply is possible
 }
 
 type RedisQueueOptions struct {
@@ -37,16 +40,20 @@ type RedisQueueOptions struct {
 	Stream     string
 	ComsumerID string
 }
-type RedisStreamMessage struct {
-	ID        string
-	MongoDBId string
-}
 type History struct {
-	Id        primitive.ObjectID `bson:"_id,omitempty"`
-	Url       string             `bson:"url,omitempty"`
-	Type      string             `bson:"type,omitempty"`
-	TotalPage int                `bson:"total_page,omitempty"`
-	Title     string             `bson:"title,omitempty"`
+	Id            primitive.ObjectID `bson:"_id,omitempty"`
+	Url           string             `bson:"url,omitempty"`
+	Type          string             `bson:"type,omitempty"`
+	TotalPage     int                `bson:"total_page,omitempty"`
+	Title         string             `bson:"title,omitempty"`
+	ReplyCount    int                `bson:"reply_count,omitempty"`
+	Author        string             `bson:"author,omitempty"`
+	LastReplyAt   time.Time          `bson:"last_reply_at,omitempty"`
+	LastCrawledAt time.Time          `bson:"last_crawled_at,omitempty"`
+	Owner         primitive.ObjectID `bson:"owner,omitempty"` //notification channels are chosen by owner
+	Status        string             `bson:"status,omitempty"`
+	FailCount     int                `bson:"fail_count,omitempty"` //permanent failures in a row
+	Delete        bool               `bson:"delete,omitempty"`     //not published any more
 }
 
 var logger *log.SugarLogger
@@ -69,8 +76,42 @@ func main() {
 
 	//redis stream
 	viper.SetDefault("log.subject", logSubject) //log
+	viper.SetDefault("log.max_len", 100000)
 	viper.SetDefault("stream.group", "backend.history.refresh.workers")
-	viper.SetDefault("stream.stream", "backend.history.refresh")
+	viper.SetDefault("stream.stream", rsmessage.RefreshStream)
+	viper.SetDefault("stream.reclaim_idle", "10m") //claim message from crashed consumer
+	viper.SetDefault("stream.max_delivery", 5)
+	viper.SetDefault("stream.dead_letter", "backend.history.refresh.dlq")
+	viper.SetDefault("stream.concurrency", 1)
+	viper.SetDefault("stream.timeout", "20s") //crawl timeout of one history
+
+	//same as history-publisher, refresh request in half of min interval after a crawl is a duplicate
+	viper.SetDefault("schedule.min_interval", "15m")
+
+	viper.SetDefault("stream.updated", rsmessage.ThreadUpdatedStream) //thread updated event
+	viper.SetDefault("stream.updated_max_len", 10000)
+
+	//crawl client, rate is requests per second of one host
+	viper.SetDefault("crawl.timeout", "10s")
+	viper.SetDefault("crawl.max_retries", 3)
+	viper.SetDefault("crawl.min_backoff", "500ms")
+	viper.SetDefault("crawl.max_backoff", "30s")
+	viper.SetDefault("crawl.rate", 1)
+	viper.SetDefault("crawl.burst", 1)
+
+	//cookies of [session.<type>.cookies] are used to crawl as logged in user
+	viper.SetDefault("session.ttl", "72h") //saved session expire if not crawled
+
+	//archive crawled page to blob storage, mode is raw or posts, empty to disable
+	viper.SetDefault("archive.mode", "")
+	viper.SetDefault("archive.backend", "local")
+	viper.SetDefault("archive.dir", "/data/archive")
+	viper.SetDefault("archive.s3.bucket", "history-archive")
+
+	//mongodb
+	//delete history after thread not found or login required in a row, 0 to keep
+	viper.SetDefault("history.max_failures", 3)
+	viper.SetDefault("snapshot.ttl", "2160h") //keep crawl snapshots for 90 days
 
 	if viper.IsSet("etcd") {
 		viper.AddRemoteProvider("etcd", viper.GetString("etcd"), viper.GetString("etcd_config_path"))
@@ -106,6 +147,7 @@ func main() {
 
 		log.Info("using redis log stream", log.String("log_stream", logStream), log.String("log_subject", subject))
 		w := log.NewRedisWriterWithAddress(viper.GetString("database.redis"), "", logStream, subject)
+		w.SetRetention(viper.GetInt64("log.max_len"), viper.GetDuration("log.max_age"))
 		logger = log.NewLogger(log.NewJsonCore(w), log.InfoLevel).Sugar()
 	}
 	defer logger.Sync()
@@ -120,6 +162,8 @@ func main() {
 		logger.Fatalw("fail connect to redis", "redis_config", redisQueueOptions, "error", err)
 	}
 	redisQueueOptions.ComsumerID = group.ConsumerID
+	group.MaxDelivery = viper.GetInt64("stream.max_delivery")
+	group.DeadLetterStream = viper.GetString("stream.dead_letter")
 
 	//init mongodb
 	ctxMongoConnect, cancel := context.WithTimeout(context.Background(), 20*time.Second)
@@ -141,198 +185,297 @@ func main() {
 
 	logger.Infow("new consumer", "group", redisQueueOptions.Group, "comsumer_id", redisQueueOptions.ComsumerID)
 
-	for {
-		msg, err := claimMessage(ctxBackground, group)
-		ctxTimeout, cancelContext := context.WithTimeout(ctxBackground, 20*time.Second)
-		if err != nil {
+	ctxSignal, stop := signal.NotifyContext(ctxBackground, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	database := mongoClient.Database(historyDatabase)
+	historyCrawler := crawler{
+		historyCol:  database.Collection(historyCol),
+		snapshotCol: database.Collection(snapshot.Collection),
+		client:      crawlclient.New(crawlConfig()),
+		maxFailures: viper.GetInt("history.max_failures"),
+	}
+	ctxIndex, cancelIndex := context.WithTimeout(ctxBackground, 10*time.Second)
+	defer cancelIndex()
+	err = snapshot.EnsureIndexes(ctxIndex, historyCrawler.snapshotCol, viper.GetDuration("snapshot.ttl"))
+	if err != nil {
+		logger.Errorw("create snapshot index error", "error", err)
+	}
+	events := rstream.RedisStream{}
+	events.New(&rstream.StreamConfig{
+		Client:    group.Client(),
+		Stream:    viper.GetString("stream.updated"),
+		Retention: rstream.Retention{MaxLen: viper.GetInt64("stream.updated_max_len")},
+	})
+	historyCrawler.events = &events
+	notifyConfig := NotifyConfig{}
+	if err = viper.UnmarshalKey("notify", &notifyConfig); err != nil {
+		logger.Fatalw("invalid notify config", "error", err)
+	}
+	historyCrawler.notify, err = newNotifyRouter(notifyConfig, group.Client())
+	if err != nil {
+		logger.Fatalw("invalid notify config", "error", err)
+	}
+	sessionConfig := map[string]SessionConfig{}
+	for site := range viper.GetStringMap("session") {
+		if site == "ttl" {
 			continue
 		}
-		historyCol := mongoClient.Database(historyDatabase).Collection(historyCol)
-		history, err := getHistory(ctxTimeout, historyCol, msg.MongoDBId)
-		if err != nil {
-			logger.Errorw("get history error", "error", err) //TODO error handler
-			continue
+		config := SessionConfig{}
+		if err = viper.UnmarshalKey("session."+site, &config); err != nil {
+			logger.Fatalw("invalid session config", "site", site, "error", err)
 		}
-		logger.Infow("get history", "history", history, "consumer_id", redisQueueOptions.ComsumerID)
-		switch history.Type {
-		case "nga":
-			err := ngaProc(ctxTimeout, &history)
-			if err != nil {
-				logger.Errorw("process nga error", "error", err)
-				continue
-			}
-		case "tieba":
-			err := tiebaProc(ctxTimeout, &history)
-			if err != nil {
-				logger.Errorw("process tieba error", "error", err)
-				continue
-			}
-		default:
-			logger.Errorw("ack with no extractor", "history", history, "type", history.Type)
-			if err := group.Ack(ctxTimeout, msg.ID); err != nil {
-				logger.Errorw("ack error", "history", history, "queue_msg", msg)
-			}
+		sessionConfig[site] = config
+	}
+	archiveConfig := ArchiveConfig{}
+	if err = viper.UnmarshalKey("archive", &archiveConfig); err != nil {
+		logger.Fatalw("invalid archive config", "error", err)
+	}
+	historyCrawler.archiver, err = newArchiver(ctxBackground, archiveConfig)
+	if err != nil {
+		logger.Fatalw("init archive error", "config", archiveConfig, "error", err)
+	}
+	historyCrawler.sessions = newSessionStore(group.Client(), viper.GetDuration("session.ttl"), sessionConfig)
+	dedup := rstream.NewDedup(group.Client(), rsmessage.RefreshDedupPrefix, viper.GetDuration("schedule.min_interval")/2)
+	pending := rstream.NewDedup(group.Client(), rsmessage.RefreshPendingPrefix, 0)
+	//pending refresh is released whenever the request is acked, or publisher skips the history until pending ttl
+	group.OnDeadLetter = func(ctx context.Context, letter rstream.DeadLetter) {
+		msg := rsmessage.RefreshRequest{}
+		if err := rstream.DecodeValues(letter.Values, &msg); err != nil || msg.HistoryID == "" {
+			logger.Errorw("decode dead letter error", "dead_letter", letter, "error", err)
+			return
 		}
-		logger.Infow("complete process", "history", history, "consumer_id", redisQueueOptions.ComsumerID)
-		err = updateHistory(ctxTimeout, historyCol, history)
+		pending.Release(ctx, msg.HistoryID)
+	}
+	pool := rstream.NewWorkerPool(&group, viper.GetInt("stream.concurrency"), func(ctx context.Context, message rstream.XMessage) error {
+		msg, err := claimMessage(ctx, message)
 		if err != nil {
-			logger.Error("mongodb update history error", "error", err)
-			continue
+			return err
 		}
-		logger.Infow("crawl success, group ack", "queue_id", msg.ID, "historyId", history.Id.Hex())
-		if err := group.Ack(ctxTimeout, msg.ID); err != nil {
-			logger.Errorw("ack error", "history", history, "queue_msg", msg)
+		ok, err := dedup.Claim(ctx, msg.HistoryID)
+		if err != nil {
+			return err
 		}
-		cancelContext()
-	}
+		if !ok {
+			logger.Infow("drop duplicate refresh request", "queue_id", message.ID, "historyId", msg.HistoryID)
+			pending.Release(context.Background(), msg.HistoryID)
+			return nil
+		}
+		err = historyCrawler.crawl(ctx, msg)
+		if err != nil {
+			dedup.Release(context.Background(), msg.HistoryID) //retry is not a duplicate
+			return err
+		}
+		logger.Infow("crawl success, group ack", "queue_id", message.ID, "historyId", msg.HistoryID)
+		pending.Release(context.Background(), msg.HistoryID)
+		return nil
+	})
+	pool.Timeout = viper.GetDuration("stream.timeout")
+	err = pool.Run(ctxSignal, rstream.WithPending(), rstream.WithReclaim(viper.GetDuration("stream.reclaim_idle")))
+	logger.Infow("graceful shutdown", "consumer_id", redisQueueOptions.ComsumerID, "reason", err)
+	ctxDisconnect, cancelDisconnect := context.WithTimeout(ctxBackground, 10*time.Second)
+	defer cancelDisconnect()
+	mongoClient.Disconnect(ctxDisconnect)
+}
+
+type crawler struct {
+	historyCol  *mongo.Collection
+	snapshotCol *mongo.Collection
+	events      *rstream.RedisStream //thread updated event
+	notify      *notifyRouter
+	client      *crawlclient.Client //shared by all extractors
+	sessions    *sessionStore
+	maxFailures int //permanent failures in a row before history is deleted
+	archiver    *archiver
 }
 
-func claimMessage(ctx context.Context, group rstream.ConsumerGroup) (msg RedisStreamMessage, err error) {
-	message, err := group.Pop()
+//crawl history of refresh request and save it
+func (c *crawler) crawl(ctx context.Context, msg rsmessage.RefreshRequest) error {
+	history, err := getHistory(ctx, c.historyCol, msg.HistoryID)
 	if err != nil {
-		return
+		logger.Errorw("get history error", "error", err)
+		return err
 	}
-	msg.ID = message.ID
-	for key, value := range message.Values {
-		switch key {
-		case "id":
-			msg.MongoDBId = value.(string)
-		}
+	logger.Infow("get history", "history", history)
+	extractor, ok := lookupExtractor(history)
+	if !ok {
+		logger.Errorw("ack with no extractor", "history", history, "type", history.Type)
+		return nil
 	}
-	logger.Infow("get message", "message", msg)
-	return msg, nil
-}
-
-func getHistory(ctx context.Context, col *mongo.Collection, historyId string) (history History, err error) {
-	id, err := primitive.ObjectIDFromHex(historyId)
+	u, err := url.Parse(history.Url)
 	if err != nil {
-		return history, err
+		logger.Errorw("ack with invalid url", "history", history, "error", err)
+		return nil
 	}
-	filter := bson.M{"_id": id}
-	result := col.FindOne(ctx, filter)
-	err = result.Decode(&history)
+	session := c.loadSession(ctx, extractor.Type(), u)
+	page, status, err := extract(ctx, c.client, extractor, &history)
 	if err != nil {
-		return history, err
+		history.Status = crawlStatus(postInformation{}, status, err)
 	}
-	return history, nil
-}
-
-func updateHistory(ctx context.Context, col *mongo.Collection, history History) error {
-	filter := bson.M{"_id": history.Id}
-	update := bson.M{"$set": bson.M{"title": history.Title, "total_page": history.TotalPage}}
-	_, err := col.UpdateOne(ctx, filter, update)
+	switch {
+	case err == nil:
+		c.saveSession(ctx, extractor.Type(), u, session)
+	//logged out page, 401 or 403, not any page failed to parse
+	case history.Status == StatusLoginRequired, status == http.StatusUnauthorized, status == http.StatusForbidden:
+		c.expireSession(ctx, extractor.Type(), u, session)
+	}
+	history.LastCrawledAt = time.Now()
+	c.snapshot(ctx, history, status, c.archive(ctx, extractor, page), err)
+	if err != nil {
+		logger.Errorw("process history error", "type", extractor.Type(), "status", history.Status, "error", err)
+		return c.failed(ctx, history, err)
+	}
+	logger.Infow("complete process", "history", history)
+	oldTotalPage, err := updateHistory(ctx, c.historyCol, history)
 	if err != nil {
+		logger.Errorw("mongodb update history error", "error", err)
 		return err
 	}
+	if history.TotalPage > oldTotalPage {
+		event := threadUpdated(history, oldTotalPage, unreadUrl(extractor, history.Url, oldTotalPage))
+		publishUpdated(ctx, c.events, event)
+		if oldTotalPage != 0 { //first crawl of history
+			c.notify.notify(ctx, event.Owner, event)
+		}
+	}
 	return nil
 }
 
-func ngaProc(ctx context.Context, history *History) error {
-	page, err := crawlPage(history.Url, ngaPostRequest)
+//save status of failed crawl, refresh request is acked on permanent failure so it is not retried forever
+func (c *crawler) failed(ctx context.Context, history History, crawlErr error) error {
+	deleted, err := markFailure(ctx, c.historyCol, history.Id, history.Status, c.maxFailures)
 	if err != nil {
-		return err
+		logger.Errorw("mongodb update history status error", "history", history, "status", history.Status, "error", err)
 	}
-	info, err := ngaExtractor(page)
-	if info.Title == "" && info.TotalPage == 0 {
-		logger.Errorw("get nga info fail", "crawl page", page, "history", history)
-		return errors.New("get info fail")
-	} else if info.Title == "" || info.TotalPage == 0 {
-		logger.Warnw("fail get all nga data", "crawl page", page, "history", history)
+	if deleted {
+		logger.Warnw("delete history after repeated failures", "history", history, "status", history.Status)
 	}
-	if err != nil {
-		return err
+	if permanentStatus(history.Status) {
+		return nil
 	}
-	history.Title = info.Title
-	history.TotalPage = info.TotalPage
-	return nil
+	return crawlErr
 }
 
-func crawlPage(crawlUrl string, postRequest postRequestFunc) (string, error) {
-	logger.Debugw("start crwaling page", "url", crawlUrl)
-	client := http.Client{}
-	req, err := postRequest(&client, crawlUrl)
-	if err != nil {
-		logger.Errorw("Error when process postReqeust function", "crawl_url", crawlUrl, "error", err)
-		return "", err
-	}
-	logger.Debugw("get request", "cookies", req.Cookies())
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Errorw("Error when request crawl url", "crawl_url", crawlUrl, "error", err)
-		return "", err
+//archive crawled page if archive mode is on, failed page is also kept. return the blob key
+func (c *crawler) archive(ctx context.Context, extractor Extractor, page string) string {
+	if c.archiver == nil || page == "" {
+		return ""
 	}
-	defer resp.Body.Close()
-	bytes, err := ioutil.ReadAll(resp.Body)
+	key, err := c.archiver.archive(ctx, extractor, page)
 	if err != nil {
-		logger.Errorw("Error read response body", "crawl_url", crawlUrl, "error", err)
+		logger.Errorw("archive page error", "type", extractor.Type(), "error", err)
+		return ""
 	}
-	return string(bytes), nil
+	return key
 }
 
-func ngaPostRequest(client *http.Client, crawlUrl string) (*http.Request, error) {
-	resp, err := client.Get(crawlUrl)
-	if err != nil {
-		return nil, err
+//snapshot is for trend only, crawl is not failed by it
+func (c *crawler) snapshot(ctx context.Context, history History, status int, archive string, crawlErr error) {
+	record := snapshot.Snapshot{
+		HistoryId: history.Id,
+		Time:      history.LastCrawledAt,
+		Status:    status,
+		Archive:   archive,
 	}
-	bytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if crawlErr != nil {
+		record.Error = crawlErr.Error()
+	} else {
+		record.TotalPage = history.TotalPage
+		record.ReplyCount = history.ReplyCount
+		record.Title = history.Title
+	}
+	if err := snapshot.Save(ctx, c.snapshotCol, record); err != nil {
+		logger.Errorw("save snapshot error", "snapshot", record, "error", err)
+	}
+}
+
+func threadUpdated(history History, oldTotalPage int, unreadUrl string) rsmessage.ThreadUpdated {
+	event := rsmessage.ThreadUpdated{
+		HistoryID:    history.Id.Hex(),
+		Type:         history.Type,
+		Url:          history.Url,
+		UnreadUrl:    unreadUrl,
+		Title:        history.Title,
+		OldTotalPage: oldTotalPage,
+		NewTotalPage: history.TotalPage,
+		ReplyCount:   history.ReplyCount,
+		LastReplyAt:  history.LastReplyAt,
+		CrawledAt:    history.LastCrawledAt,
 	}
-	defer resp.Body.Close()
-	respText := string(bytes)
-	regGuestJs := regexp.MustCompile(`guestJs=(\d+)`)
-	guestJsRow := regGuestJs.FindStringSubmatch(respText)
-	if len(guestJsRow) < 2 {
-		return nil, errors.New("can not find guestJs")
+	if !history.Owner.IsZero() {
+		event.Owner = history.Owner.Hex()
 	}
-	guestJs := guestJsRow[1]
-	req, err := http.NewRequest("GET", crawlUrl, nil)
+	return event
+}
+
+//history is already saved, so the event is not retried if publish fails
+func publishUpdated(ctx context.Context, events *rstream.RedisStream, event rsmessage.ThreadUpdated) {
+	id, err := rstream.Publish(ctx, events, event)
 	if err != nil {
-		return nil, err
+		logger.Errorw("publish thread updated event error", "event", event, "error", err)
+		return
 	}
+	logger.Infow("thread updated", "event", event, "message_id", id)
+}
 
-	cookie := http.Cookie{
-		Name:    "guestJs",
-		Value:   guestJs,
-		Expires: time.Now().Local().Add(time.Second * 12000),
-		Domain:  "bbs.nga.cn",
+func crawlConfig() crawlclient.Config {
+	config := crawlclient.DefaultConfig()
+	config.Timeout = viper.GetDuration("crawl.timeout")
+	config.MaxRetries = viper.GetInt("crawl.max_retries")
+	config.MinBackoff = viper.GetDuration("crawl.min_backoff")
+	config.MaxBackoff = viper.GetDuration("crawl.max_backoff")
+	config.Rate = viper.GetFloat64("crawl.rate")
+	config.Burst = viper.GetInt("crawl.burst")
+	if hostRates := viper.GetStringMap("crawl.host_rate"); len(hostRates) != 0 { //host has dot, not read by key path
+		config.HostRates = map[string]float64{}
+		for host, rate := range hostRates {
+			config.HostRates[host] = cast.ToFloat64(rate)
+		}
 	}
-	req.AddCookie(&cookie)
-	time.Sleep(time.Second * 1)
-	return req, nil
+	return config
 }
 
-func ngaExtractor(text string) (information postInformation, err error) {
-	//TODO more accurate way to detect charset
-	text, err = GBKToUTF8(text)
+func claimMessage(ctx context.Context, message rstream.XMessage) (msg rsmessage.RefreshRequest, err error) {
+	msg, err = rstream.Decode[rsmessage.RefreshRequest](message)
 	if err != nil {
-		return information, errors.New("string encoding fail")
-	}
-	regTitle := regexp.MustCompile(`<title>(.+?)</title>`)
-	titleRaw := regTitle.FindStringSubmatch(text)
-	if len(titleRaw) < 2 {
-		return information, errors.New("can not find title")
+		logger.Errorw("decode message error", "message_id", message.ID, "values", message.Values, "error", err)
+		return
 	}
-	information.Title = titleRaw[1]
+	logger.Infow("get message", "message_id", message.ID, "message", msg)
+	return msg, nil
+}
 
-	regTotalPage := regexp.MustCompile(`__PAGE.+?,\d+:(\d*)`)
-	totalPageRaw := regTotalPage.FindStringSubmatch(text)
-	if len(totalPageRaw) < 2 {
-		return information, errors.New("can not find total page")
+func getHistory(ctx context.Context, col *mongo.Collection, historyId string) (history History, err error) {
+	id, err := primitive.ObjectIDFromHex(historyId)
+	if err != nil {
+		return history, err
 	}
-	totalPage, err := strconv.Atoi(totalPageRaw[1])
+	filter := bson.M{"_id": id}
+	result := col.FindOne(ctx, filter)
+	err = result.Decode(&history)
 	if err != nil {
-		return information, errors.New("can not find total page")
+		return history, err
 	}
-	information.TotalPage = totalPage
-	return information, nil
+	return history, nil
 }
 
-func GBKToUTF8(s string) (string, error) {
-	reader := transform.NewReader(bytes.NewReader([]byte(s)), simplifiedchinese.GBK.NewDecoder())
-	d, err := ioutil.ReadAll(reader)
+//save crawled fields, return total page before update
+func updateHistory(ctx context.Context, col *mongo.Collection, history History) (oldTotalPage int, err error) {
+	filter := bson.M{"_id": history.Id}
+	set := bson.M{"title": history.Title, "total_page": history.TotalPage, "last_crawled_at": history.LastCrawledAt, "status": history.Status, "fail_count": 0}
+	if history.ReplyCount != 0 {
+		set["reply_count"] = history.ReplyCount
+	}
+	if history.Author != "" {
+		set["author"] = history.Author
+	}
+	if !history.LastReplyAt.IsZero() {
+		set["last_reply_at"] = history.LastReplyAt
+	}
+	old := History{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before).SetProjection(bson.M{"total_page": 1})
+	err = col.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&old)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
-	return string(d), nil
+	return old.TotalPage, nil
 }
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"net/http"
+	"context"
 	"testing"
 
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,16 +13,16 @@ func TestCrawlPage(t *testing.T) {
 }
 
 func TestNgaPostRequest(t *testing.T) {
-	client := http.Client{}
-	req, err := ngaPostRequest(&client, "https://bbs.nga.cn/read.php?tid=27536822&page=57")
+	client := crawlclient.New(crawlclient.DefaultConfig())
+	req, err := ngaPostRequest(context.Background(), client, "https://bbs.nga.cn/read.php?tid=27536822&page=57")
 	if err != nil {
-		t.Log(err)
+		t.Fatal(err)
 	}
-	guestJs, err := req.Cookie("guestJs")
-	if err != nil {
-		t.Error(err)
+	cookies := client.Jar().Cookies(req.URL)
+	if len(cookies) == 0 {
+		t.Error("no guestJs cookie")
 	}
-	t.Log(guestJs)
+	t.Log(cookies)
 }
 
 func TestNgaExtractor(t *testing.T) {
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
+)
+
+func init() {
+	Register(nga{})
+}
+
+type nga struct{}
+
+//message of error page, e.g. thread is hidden
+var regNgaMessage = regexp.MustCompile(`<!--msginfostart-->(.*?)<!--msginfoend-->`)
+
+//notice of locked thread, only searched in its own element since a post may quote it
+const ngaLockedText = "本帖已锁定"
+
+func (nga) Type() string {
+	return "nga"
+}
+
+func (nga) Match(u *url.URL) bool {
+	switch u.Hostname() {
+	case "bbs.nga.cn", "ngabbs.com", "nga.178.com":
+		return u.Path == "/read.php"
+	}
+	return false
+}
+
+//guestJs is fetched only if the session has neither guest nor login cookie
+func (nga) Request(ctx context.Context, client *crawlclient.Client, crawlUrl string) (*http.Request, error) {
+	u, err := url.Parse(crawlUrl)
+	if err != nil {
+		return nil, err
+	}
+	for _, cookie := range client.Jar().Cookies(u) {
+		if cookie.Name == "guestJs" || cookie.Name == "ngaPassportUid" {
+			return http.NewRequestWithContext(ctx, "GET", crawlUrl, nil)
+		}
+	}
+	return ngaPostRequest(ctx, client, crawlUrl)
+}
+
+func (nga) Parse(page string) (postInformation, error) {
+	return ngaExtractor(page)
+}
+
+//guestJs cookie is set by javascript of the first response, it is kept in the client jar
+func ngaPostRequest(ctx context.Context, client *crawlclient.Client, crawlUrl string) (*http.Request, error) {
+	resp, err := client.Get(ctx, crawlUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	respText := string(bytes)
+	regGuestJs := regexp.MustCompile(`guestJs=(\d+)`)
+	guestJsRow := regGuestJs.FindStringSubmatch(respText)
+	if len(guestJsRow) < 2 {
+		return nil, errors.New("can not find guestJs")
+	}
+	guestJs := guestJsRow[1]
+	req, err := http.NewRequestWithContext(ctx, "GET", crawlUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Jar().SetCookies(req.URL, []*http.Cookie{{
+		Name:    "guestJs",
+		Value:   guestJs,
+		Path:    "/",
+		Expires: time.Now().Local().Add(time.Second * 12000),
+	}})
+	return req, nil
+}
+
+func ngaExtractor(text string) (information postInformation, err error) {
+	if message := lastSubmatch(regNgaMessage, text); message != "" { //error page instead of thread
+		if strings.Contains(message, "删除") || strings.Contains(message, "隐藏") || strings.Contains(message, "不存在") {
+			return information, fmt.Errorf("%w: %s", ErrThreadDeleted, message)
+		}
+		if strings.Contains(message, "登录") {
+			return information, fmt.Errorf("%w: %s", ErrLoginRequired, message)
+		}
+		return information, fmt.Errorf("nga error: %s", message)
+	}
+	doc, err := parseDocument(text)
+	if err != nil {
+		return information, err
+	}
+	information.Title = selectText(doc, "title")
+	if information.Title == "" {
+		return information, missingField("nga", "title")
+	}
+	//__PAGE = {0:url,1:total page,2:current page,3:posts per page}
+	pager, _ := embeddedObject(scriptText(doc, "__PAGE"), "__PAGE")
+	totalPage, ok := jsInt(pager, "1")
+	if !ok {
+		return information, missingField("nga", "total page")
+	}
+	information.TotalPage = totalPage
+	information.Locked = strings.Contains(selectText(doc, "#m_threadnotice"), ngaLockedText)
+
+	//optional, last reply is the last floor of the crawled page
+	information.Author = selectText(doc, "#postauthor0")
+	if postDate := strings.TrimSpace(doc.Find("span[id^='postdate']").Last().Text()); postDate != "" {
+		information.LastReplyAt, _ = time.ParseInLocation("2006-01-02 15:04", postDate, chinaTime)
+	}
+	return information, nil
+}
+
+//posts of the crawled page, floor is the number in element id
+func (nga) Posts(page string) ([]Post, error) {
+	doc, err := parseDocument(page)
+	if err != nil {
+		return nil, err
+	}
+	posts := []Post{}
+	doc.Find("span[id^='postcontent']").Each(func(_ int, content *goquery.Selection) {
+		id, _ := content.Attr("id")
+		floor := strings.TrimPrefix(id, "postcontent")
+		post := Post{Content: strings.TrimSpace(content.Text())}
+		post.Floor, _ = strconv.Atoi(floor)
+		post.Author = selectText(doc, "#postauthor"+floor)
+		if postDate := selectText(doc, "#postdate"+floor); postDate != "" {
+			post.Time, _ = time.ParseInLocation("2006-01-02 15:04", postDate, chinaTime)
+		}
+		posts = append(posts, post)
+	})
+	return posts, nil
+}
+
+func (nga) PageUrl(crawlUrl string, page int) string {
+	return setPageQuery(crawlUrl, "page", page)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	rsmessage "github.com/lyineee/go-learn/redis-stream/message"
+)
+
+const defaultBarkServer = "https://api.day.app"
+
+//one notification channel in config, Type is bark, webhook or stream
+type NotifyChannel struct {
+	Type   string `mapstructure:"type"`
+	Token  string `mapstructure:"token"`  //bark device key
+	Server string `mapstructure:"server"` //bark server, default https://api.day.app
+	Url    string `mapstructure:"url"`    //webhook url
+	Stream string `mapstructure:"stream"` //redis stream
+}
+
+//channels of history owner, Default is used for history without owner config
+type NotifyConfig struct {
+	Default []NotifyChannel            `mapstructure:"default"`
+	Owners  map[string][]NotifyChannel `mapstructure:"owners"` //key is owner id in hex
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, event rsmessage.ThreadUpdated) error
+}
+
+type barkNotifier struct {
+	client *http.Client
+	server string
+	token  string
+}
+
+func (n barkNotifier) Notify(ctx context.Context, event rsmessage.ThreadUpdated) error {
+	payload, err := json.Marshal(map[string]string{
+		"device_key": n.token,
+		"title":      event.Title,
+		"body":       fmt.Sprintf("更新到第 %d 页", event.NewTotalPage),
+		"url":        event.UnreadUrl,
+		"group":      "history",
+	})
+	if err != nil {
+		return err
+	}
+	return postJson(ctx, n.client, n.server+"/push", payload)
+}
+
+//post ThreadUpdated as json
+type webhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func (n webhookNotifier) Notify(ctx context.Context, event rsmessage.ThreadUpdated) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postJson(ctx, n.client, n.url, payload)
+}
+
+type streamNotifier struct {
+	stream *rstream.RedisStream
+}
+
+func (n streamNotifier) Notify(ctx context.Context, event rsmessage.ThreadUpdated) error {
+	_, err := rstream.Publish(ctx, n.stream, event)
+	return err
+}
+
+func postJson(ctx context.Context, client *http.Client, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		c, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s return with %d: %s", url, resp.StatusCode, string(c))
+	}
+	return nil
+}
+
+//notifiers of each owner
+type notifyRouter struct {
+	defaults []Notifier
+	owners   map[string][]Notifier
+}
+
+func newNotifyRouter(config NotifyConfig, rdb *redis.Client) (*notifyRouter, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	build := func(channels []NotifyChannel) ([]Notifier, error) {
+		notifiers := []Notifier{}
+		for _, channel := range channels {
+			switch channel.Type {
+			case "bark":
+				server := channel.Server
+				if server == "" {
+					server = defaultBarkServer
+				}
+				notifiers = append(notifiers, barkNotifier{client: client, server: server, token: channel.Token})
+			case "webhook":
+				notifiers = append(notifiers, webhookNotifier{client: client, url: channel.Url})
+			case "stream":
+				stream := rstream.RedisStream{}
+				stream.New(&rstream.StreamConfig{Client: rdb, Stream: channel.Stream})
+				notifiers = append(notifiers, streamNotifier{stream: &stream})
+			default:
+				return nil, fmt.Errorf("unknown notify channel type %q", channel.Type)
+			}
+		}
+		return notifiers, nil
+	}
+	router := notifyRouter{owners: map[string][]Notifier{}}
+	var err error
+	if router.defaults, err = build(config.Default); err != nil {
+		return nil, err
+	}
+	for owner, channels := range config.Owners {
+		if router.owners[owner], err = build(channels); err != nil {
+			return nil, fmt.Errorf("owner %s: %w", owner, err)
+		}
+	}
+	return &router, nil
+}
+
+func (router *notifyRouter) notifiers(owner string) []Notifier {
+	if notifiers, ok := router.owners[owner]; ok {
+		return notifiers
+	}
+	return router.defaults
+}
+
+//send to every channel of the owner, return the last error
+func (router *notifyRouter) notify(ctx context.Context, owner string, event rsmessage.ThreadUpdated) (err error) {
+	for _, notifier := range router.notifiers(owner) {
+		if e := notifier.Notify(ctx, event); e != nil {
+			logger.Errorw("send notification error", "owner", owner, "notifier", fmt.Sprintf("%T", notifier), "event", event, "error", e)
+			err = e
+		}
+	}
+	return
+}
+
+//optional interface of Extractor
+type PageLinker interface {
+	PageUrl(crawlUrl string, page int) string
+}
+
+//link to the first unread page, new replies start on the old last page
+func unreadUrl(extractor Extractor, crawlUrl string, oldTotalPage int) string {
+	linker, ok := extractor.(PageLinker)
+	if !ok {
+		return crawlUrl
+	}
+	if oldTotalPage < 1 {
+		oldTotalPage = 1
+	}
+	return linker.PageUrl(crawlUrl, oldTotalPage)
+}
+
+//set page query of url, crawlUrl is returned if it is invalid
+func setPageQuery(crawlUrl, key string, page int) string {
+	u, err := url.Parse(crawlUrl)
+	if err != nil {
+		return crawlUrl
+	}
+	query := u.Query()
+	query.Set(key, strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	u.Fragment = ""
+	return u.String()
+}
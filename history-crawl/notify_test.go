@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rsmessage "github.com/lyineee/go-learn/redis-stream/message"
+	"github.com/lyineee/go-learn/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyRouter(t *testing.T) {
+	logger = utils.GetLogger().Sugar()
+	ast := assert.New(t)
+	bark := map[string]string{}
+	barkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ast.Equal("/push", r.URL.Path)
+		ast.Nil(json.NewDecoder(r.Body).Decode(&bark))
+	}))
+	defer barkServer.Close()
+	webhook := rsmessage.ThreadUpdated{}
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ast.Nil(json.NewDecoder(r.Body).Decode(&webhook))
+	}))
+	defer webhookServer.Close()
+
+	router, err := newNotifyRouter(NotifyConfig{
+		Default: []NotifyChannel{{Type: "webhook", Url: webhookServer.URL}},
+		Owners: map[string][]NotifyChannel{
+			"620b8a": {{Type: "bark", Server: barkServer.URL, Token: "device"}},
+		},
+	}, nil)
+	ast.Nil(err)
+	event := rsmessage.ThreadUpdated{
+		HistoryID:    "620b8b",
+		Title:        "【安科漫画】魔物训使",
+		UnreadUrl:    "https://tieba.baidu.com/p/7278674944?pn=35",
+		OldTotalPage: 35,
+		NewTotalPage: 36,
+	}
+
+	ast.Nil(router.notify(context.Background(), "620b8a", event))
+	ast.Equal("device", bark["device_key"])
+	ast.Equal(event.Title, bark["title"])
+	ast.Equal(event.UnreadUrl, bark["url"])
+	ast.Empty(webhook.HistoryID)
+
+	ast.Nil(router.notify(context.Background(), "", event))
+	ast.Equal(event, webhook)
+
+	_, err = newNotifyRouter(NotifyConfig{Default: []NotifyChannel{{Type: "mail"}}}, nil)
+	ast.NotNil(err)
+}
+
+func TestUnreadUrl(t *testing.T) {
+	ast := assert.New(t)
+	ast.Equal("https://bbs.nga.cn/read.php?page=22&tid=29824736", unreadUrl(nga{}, "https://bbs.nga.cn/read.php?tid=29824736&page=3", 22))
+	ast.Equal("https://tieba.baidu.com/p/7278674944?pn=35", unreadUrl(tieba{}, "https://tieba.baidu.com/p/7278674944", 35))
+	ast.Equal("https://www.v2ex.com/t/836492?p=1", unreadUrl(v2ex{}, "https://www.v2ex.com/t/836492#reply50", 0))
+	ast.Equal("https://www.zhihu.com/question/19550225", unreadUrl(zhihu{}, "https://www.zhihu.com/question/19550225", 128))
+}
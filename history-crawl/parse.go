@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+//required field not found in crawled page
+type MissingFieldError struct {
+	Type  string //extractor type
+	Field string
+}
+
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("%s: can not find %s", e.Type, e.Field)
+}
+
+func missingField(extractorType, field string) error {
+	return &MissingFieldError{Type: extractorType, Field: field}
+}
+
+func parseDocument(page string) (*goquery.Document, error) {
+	return goquery.NewDocumentFromReader(strings.NewReader(page))
+}
+
+//trimmed text of the first node matching selector
+func selectText(doc *goquery.Document, selector string) string {
+	return strings.TrimSpace(doc.Find(selector).First().Text())
+}
+
+//attribute of the first node matching selector
+func selectAttr(doc *goquery.Document, selector, attr string) string {
+	value, _ := doc.Find(selector).First().Attr(attr)
+	return strings.TrimSpace(value)
+}
+
+//text of the first script containing substr
+func scriptText(doc *goquery.Document, substr string) string {
+	text := ""
+	doc.Find("script").EachWithBreak(func(_ int, script *goquery.Selection) bool {
+		if s := script.Text(); strings.Contains(s, substr) {
+			text = s
+			return false
+		}
+		return true
+	})
+	return text
+}
+
+//object literal assigned to name in a script, e.g. `PageData.pager = {...}` or `pager: {...}`
+func embeddedObject(text, name string) (string, bool) {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], name)
+		if i < 0 {
+			return "", false
+		}
+		rest := strings.TrimLeft(text[offset+i+len(name):], " \t\r\n")
+		offset += i + len(name)
+		if rest == "" || (rest[0] != '=' && rest[0] != ':') {
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+		if object, ok := balancedObject(rest); ok {
+			return object, true
+		}
+	}
+}
+
+//leading {...} of text, braces in quoted strings are skipped
+func balancedObject(text string) (string, bool) {
+	if !strings.HasPrefix(text, "{") {
+		return "", false
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return text[:i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+//unmarshal json object assigned to name in a script
+func embeddedJSON(text, name string, v interface{}) error {
+	object, ok := embeddedObject(text, name)
+	if !ok {
+		return fmt.Errorf("can not find %s", name)
+	}
+	return json.Unmarshal([]byte(object), v)
+}
+
+//value of key in a javascript object literal, which is not always valid json,
+//quoted string is unquoted
+func jsValue(object, key string) (string, bool) {
+	re := regexp.MustCompile(`(?:^|[{,\s])["']?` + regexp.QuoteMeta(key) + `["']?\s*:\s*("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|[^,}\s]+)`)
+	match := re.FindStringSubmatch(object)
+	if match == nil {
+		return "", false
+	}
+	value := match[1]
+	switch value[0] {
+	case '"':
+		s := ""
+		if err := json.Unmarshal([]byte(value), &s); err != nil {
+			return value[1 : len(value)-1], true
+		}
+		return s, true
+	case '\'':
+		return value[1 : len(value)-1], true
+	}
+	return value, true
+}
+
+//integer value of key in a javascript object literal
+func jsInt(object, key string) (int, bool) {
+	value, ok := jsValue(object, key)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil
+}
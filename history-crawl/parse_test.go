@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddedObject(t *testing.T) {
+	ast := assert.New(t)
+	text := `PageData.user.is_login ? [] : {}; PageData.thread = {author: "a}b", title: '回复：{标题}', reply_num:1824, topic: {is_topic: false}};`
+	object, ok := embeddedObject(text, "PageData.thread")
+	ast.True(ok)
+	ast.Equal(`{author: "a}b", title: '回复：{标题}', reply_num:1824, topic: {is_topic: false}}`, object)
+
+	value, ok := jsValue(object, "author")
+	ast.True(ok)
+	ast.Equal("a}b", value)
+	value, _ = jsValue(object, "title")
+	ast.Equal("回复：{标题}", value)
+	n, ok := jsInt(object, "reply_num")
+	ast.True(ok)
+	ast.Equal(1824, n)
+	_, ok = jsValue(object, "num")
+	ast.False(ok)
+
+	_, ok = embeddedObject(text, "PageData.user")
+	ast.False(ok)
+
+	pager := struct {
+		TotalPage int `json:"total_page"`
+	}{}
+	ast.Nil(embeddedJSON(`PageData.pager = {"cur_page":1,"total_page":70};`, "PageData.pager", &pager))
+	ast.Equal(70, pager.TotalPage)
+	ast.NotNil(embeddedJSON(`PageData.pager = null;`, "PageData.pager", &pager))
+}
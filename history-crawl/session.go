@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const sessionPrefix = "history-crawl.session"
+
+//cookies of a logged in browser, key of config is extractor type, e.g.
+//[session.tieba.cookies] BDUSS="..."
+type SessionConfig struct {
+	Cookies map[string]string `mapstructure:"cookies"`
+}
+
+//cookies of a site kept between crawls, guest cookies included
+type Session struct {
+	Cookies   map[string]string    `json:"cookies"`
+	Expires   map[string]time.Time `json:"expires,omitempty"` //expiry of cookies set with one, e.g. guestJs of nga
+	Login     bool                 `json:"login"`             //has cookies of config
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+//sessions persisted in redis, so the guest cookie dance is not done on every crawl
+type sessionStore struct {
+	rdb    *redis.Client
+	ttl    time.Duration
+	config map[string]SessionConfig
+}
+
+func newSessionStore(rdb *redis.Client, ttl time.Duration, config map[string]SessionConfig) *sessionStore {
+	return &sessionStore{rdb: rdb, ttl: ttl, config: config}
+}
+
+func (store *sessionStore) key(site string) string {
+	return sessionPrefix + ":" + site
+}
+
+//saved session of site, cookies of config override saved ones so changed credentials take effect
+func (store *sessionStore) load(ctx context.Context, site string) (Session, error) {
+	session := Session{}
+	raw, err := store.rdb.Get(ctx, store.key(site)).Bytes()
+	if err != nil && err != redis.Nil {
+		return session, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, &session); err != nil {
+			logger.Warnw("drop invalid session", "site", site, "session", string(raw), "error", err)
+			session = Session{}
+		}
+	}
+	if session.Cookies == nil {
+		session.Cookies = map[string]string{}
+	}
+	//expired cookie is dropped, so the site sets a new one
+	now := time.Now()
+	for name, expires := range session.Expires {
+		if !expires.After(now) {
+			delete(session.Cookies, name)
+			delete(session.Expires, name)
+		}
+	}
+	if config := store.config[site]; len(config.Cookies) != 0 {
+		for name, value := range config.Cookies {
+			session.Cookies[name] = value
+			delete(session.Expires, name)
+		}
+		session.Login = true
+	}
+	return session, nil
+}
+
+func (store *sessionStore) save(ctx context.Context, site string, session Session) error {
+	session.UpdatedAt = time.Now()
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return store.rdb.Set(ctx, store.key(site), raw, store.ttl).Err()
+}
+
+//drop saved session, next crawl starts with cookies of config only
+func (store *sessionStore) expire(ctx context.Context, site string) error {
+	return store.rdb.Del(ctx, store.key(site)).Err()
+}
+
+//put session cookies into client jar for crawl url, sessions are optional
+func (c *crawler) loadSession(ctx context.Context, site string, u *url.URL) Session {
+	if c.sessions == nil {
+		return Session{}
+	}
+	session, err := c.sessions.load(ctx, site)
+	if err != nil {
+		logger.Errorw("load session error, crawl as guest", "site", site, "error", err)
+		return session
+	}
+	cookies := make([]*http.Cookie, 0, len(session.Cookies))
+	for name, value := range session.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/", Expires: session.Expires[name]})
+	}
+	c.client.Jar().SetCookies(u, cookies)
+	return session
+}
+
+//keep cookies set by the site during crawl
+func (c *crawler) saveSession(ctx context.Context, site string, u *url.URL, session Session) {
+	if c.sessions == nil {
+		return
+	}
+	if session.Cookies == nil {
+		session.Cookies = map[string]string{}
+	}
+	if session.Expires == nil {
+		session.Expires = map[string]time.Time{}
+	}
+	for _, cookie := range c.client.Jar().Cookies(u) {
+		session.Cookies[cookie.Name] = cookie.Value
+		if expires := c.client.CookieExpires(u, cookie.Name); !expires.IsZero() {
+			session.Expires[cookie.Name] = expires
+		} else {
+			delete(session.Expires, cookie.Name)
+		}
+	}
+	if len(session.Cookies) == 0 {
+		return
+	}
+	if err := c.sessions.save(ctx, site, session); err != nil {
+		logger.Errorw("save session error", "site", site, "error", err)
+	}
+}
+
+//remove session cookies from client jar and redis, so guest cookies are fetched again
+func (c *crawler) expireSession(ctx context.Context, site string, u *url.URL, session Session) {
+	if c.sessions == nil {
+		return
+	}
+	names := []string{}
+	for name := range session.Cookies {
+		names = append(names, name)
+	}
+	for _, cookie := range c.client.Jar().Cookies(u) {
+		names = append(names, cookie.Name)
+	}
+	c.client.DeleteCookies(u, names...)
+	if err := c.sessions.expire(ctx, site); err != nil {
+		logger.Errorw("expire session error", "site", site, "error", err)
+	}
+	if session.Login {
+		logger.Warnw("session expired, cookies of config may be out of date", "site", site)
+	}
+}
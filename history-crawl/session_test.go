@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
+	"github.com/lyineee/go-learn/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSessionStore(t *testing.T, config map[string]SessionConfig) *sessionStore {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skip("redis not available", err)
+	}
+	store := newSessionStore(rdb, time.Minute, config)
+	t.Cleanup(func() {
+		store.expire(context.Background(), "test")
+		rdb.Close()
+	})
+	return store
+}
+
+func TestSessionStore(t *testing.T) {
+	logger = utils.GetLogger().Sugar()
+	ast := assert.New(t)
+	ctx := context.Background()
+	store := testSessionStore(t, map[string]SessionConfig{"test": {Cookies: map[string]string{"uid": "1"}}})
+
+	session, err := store.load(ctx, "test")
+	ast.Nil(err)
+	ast.True(session.Login)
+	ast.Equal(map[string]string{"uid": "1"}, session.Cookies)
+
+	session.Cookies["guest"] = "a"
+	session.Cookies["uid"] = "0"
+	ast.Nil(store.save(ctx, "test", session))
+	session, err = store.load(ctx, "test")
+	ast.Nil(err)
+	ast.Equal(map[string]string{"uid": "1", "guest": "a"}, session.Cookies)
+
+	//expired cookie is not revived, cookie of config never expires
+	session.Cookies["guestJs"] = "b"
+	session.Expires = map[string]time.Time{"guestJs": time.Now().Add(-time.Second), "guest": time.Now().Add(time.Hour), "uid": time.Now().Add(-time.Second)}
+	ast.Nil(store.save(ctx, "test", session))
+	session, err = store.load(ctx, "test")
+	ast.Nil(err)
+	ast.Equal(map[string]string{"uid": "1", "guest": "a"}, session.Cookies)
+	ast.Len(session.Expires, 1)
+	ast.Contains(session.Expires, "guest")
+
+	ast.Nil(store.expire(ctx, "test"))
+	session, err = store.load(ctx, "test")
+	ast.Nil(err)
+	ast.Equal(map[string]string{"uid": "1"}, session.Cookies)
+}
+
+func TestCrawlerSession(t *testing.T) {
+	logger = utils.GetLogger().Sugar()
+	ast := assert.New(t)
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("uid")
+		ast.Nil(err)
+		ast.Equal("1", cookie.Value)
+		http.SetCookie(w, &http.Cookie{Name: "guest", Value: "a", MaxAge: 3600})
+	}))
+	defer server.Close()
+	c := crawler{
+		client:   crawlclient.New(crawlclient.DefaultConfig()),
+		sessions: testSessionStore(t, map[string]SessionConfig{"test": {Cookies: map[string]string{"uid": "1"}}}),
+	}
+	u, _ := url.Parse(server.URL)
+
+	session := c.loadSession(ctx, "test", u)
+	resp, err := c.client.Get(ctx, server.URL)
+	ast.Nil(err)
+	resp.Body.Close()
+	c.saveSession(ctx, "test", u, session)
+	saved, err := c.sessions.load(ctx, "test")
+	ast.Nil(err)
+	ast.Equal("a", saved.Cookies["guest"])
+	ast.WithinDuration(time.Now().Add(time.Hour), saved.Expires["guest"], time.Minute)
+	ast.NotContains(saved.Expires, "uid")
+
+	//expiry is kept by a new client
+	c.client = crawlclient.New(crawlclient.DefaultConfig())
+	c.loadSession(ctx, "test", u)
+	ast.Equal(saved.Expires["guest"], c.client.CookieExpires(u, "guest"))
+
+	c.expireSession(ctx, "test", u, saved)
+	ast.Empty(c.client.Jar().Cookies(u))
+	saved, err = c.sessions.load(ctx, "test")
+	ast.Nil(err)
+	ast.Empty(saved.Cookies["guest"])
+}
+
+//guest cookie dance is skipped if the session has the cookie
+func TestNgaSessionRequest(t *testing.T) {
+	ast := assert.New(t)
+	client := crawlclient.New(crawlclient.DefaultConfig())
+	u, _ := url.Parse("https://bbs.nga.cn/read.php?tid=29824736")
+	client.Jar().SetCookies(u, []*http.Cookie{{Name: "guestJs", Value: "1645000000", Path: "/"}})
+	req, err := nga{}.Request(context.Background(), client, u.String())
+	ast.Nil(err)
+	ast.Equal(u.String(), req.URL.String())
+}
+
+func TestTiebaLoginPage(t *testing.T) {
+	ast := assert.New(t)
+	page := fixture(t, "tieba.html")
+	info, err := tiebaExtractor(page)
+	ast.Nil(err)
+	ast.Equal(35, info.TotalPage)
+	info, err = tiebaExtractor(`PageData.user = {"id":1172997347,"is_login":1};` + page)
+	ast.Nil(err)
+	ast.Equal(70, info.TotalPage)
+	info, err = tiebaExtractor(strings.Replace(page, `"total_page":70`, `"total_page":71`, 1))
+	ast.Nil(err)
+	ast.Equal(36, info.TotalPage) //last guest page is half full
+}
@@ -0,0 +1,90 @@
+//crawl results of history, appended on every crawl for trend of threads.
+//also used by dashboard to chart thread activity
+package snapshot
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//collection in database of history
+const Collection = "history_snapshots"
+
+//result of one crawl, failed crawl has Error set
+type Snapshot struct {
+	Id         primitive.ObjectID `bson:"_id,omitempty"`
+	HistoryId  primitive.ObjectID `bson:"history_id"`
+	Time       time.Time          `bson:"time"`
+	TotalPage  int                `bson:"total_page"`
+	ReplyCount int                `bson:"reply_count,omitempty"`
+	Title      string             `bson:"title,omitempty"`
+	Status     int                `bson:"status"` //http status, 0 if request fail
+	Error      string             `bson:"error,omitempty"`
+	Archive    string             `bson:"archive,omitempty"` //blob key of archived page
+}
+
+//growth of a thread in a time range
+type Growth struct {
+	HistoryId   primitive.ObjectID
+	From        time.Time
+	To          time.Time
+	Snapshots   []Snapshot //successful crawls in time order
+	PageGrowth  int
+	ReplyGrowth int
+}
+
+//index for growth query and ttl on time, ttl 0 keeps snapshots forever.
+//the ttl index is not changed if it already exists with another ttl
+func EnsureIndexes(ctx context.Context, col *mongo.Collection, ttl time.Duration) error {
+	indexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "history_id", Value: 1}, {Key: "time", Value: 1}},
+		Options: options.Index().SetName("history_id_time"),
+	}}
+	if ttl > 0 {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: "time", Value: 1}},
+			Options: options.Index().SetName("time_ttl").SetExpireAfterSeconds(int32(ttl / time.Second)),
+		})
+	}
+	_, err := col.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func Save(ctx context.Context, col *mongo.Collection, snapshot Snapshot) error {
+	_, err := col.InsertOne(ctx, snapshot)
+	return err
+}
+
+//successful snapshots of history in [from, to)
+func QueryGrowth(ctx context.Context, col *mongo.Collection, historyId primitive.ObjectID, from, to time.Time) (growth Growth, err error) {
+	filter := bson.M{
+		"history_id": historyId,
+		"time":       bson.M{"$gte": from, "$lt": to},
+		"error":      bson.M{"$exists": false},
+	}
+	cur, err := col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "time", Value: 1}}))
+	if err != nil {
+		return
+	}
+	snapshots := []Snapshot{}
+	if err = cur.All(ctx, &snapshots); err != nil {
+		return
+	}
+	return newGrowth(historyId, from, to, snapshots), nil
+}
+
+func newGrowth(historyId primitive.ObjectID, from, to time.Time, snapshots []Snapshot) Growth {
+	growth := Growth{HistoryId: historyId, From: from, To: to, Snapshots: snapshots}
+	if len(snapshots) < 2 {
+		return growth
+	}
+	first, last := snapshots[0], snapshots[len(snapshots)-1]
+	growth.PageGrowth = last.TotalPage - first.TotalPage
+	growth.ReplyGrowth = last.ReplyCount - first.ReplyCount
+	return growth
+}
@@ -0,0 +1,28 @@
+package snapshot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewGrowth(t *testing.T) {
+	ast := assert.New(t)
+	id := primitive.NewObjectID()
+	from := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(72 * time.Hour)
+
+	growth := newGrowth(id, from, to, []Snapshot{
+		{HistoryId: id, Time: from.Add(time.Hour), TotalPage: 20, ReplyCount: 400, Status: 200},
+		{HistoryId: id, Time: from.Add(9 * time.Hour), TotalPage: 21, ReplyCount: 430, Status: 200},
+		{HistoryId: id, Time: from.Add(17 * time.Hour), TotalPage: 23, ReplyCount: 452, Status: 200},
+	})
+	ast.Equal(3, growth.PageGrowth)
+	ast.Equal(52, growth.ReplyGrowth)
+	ast.Len(growth.Snapshots, 3)
+
+	growth = newGrowth(id, from, to, []Snapshot{{HistoryId: id, Time: from, TotalPage: 20}})
+	ast.Equal(0, growth.PageGrowth)
+}
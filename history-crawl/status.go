@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrThreadDeleted = errors.New("thread deleted or hidden")
+	ErrLoginRequired = errors.New("login required")
+)
+
+//crawl result saved as status of history
+const (
+	StatusOK            = "ok"
+	StatusNotFound      = "not_found"
+	StatusLoginRequired = "login_required"
+	StatusLocked        = "locked"  //crawled, but no new reply is possible
+	StatusFailing       = "failing" //network error, server error or unknown page, retried
+)
+
+//classify result of extract by its error and http status of the page
+func crawlStatus(info postInformation, httpStatus int, err error) string {
+	switch {
+	case err == nil && info.Locked:
+		return StatusLocked
+	case err == nil:
+		return StatusOK
+	case errors.Is(err, ErrThreadDeleted), httpStatus == http.StatusNotFound, httpStatus == http.StatusGone:
+		return StatusNotFound
+	case errors.Is(err, ErrLoginRequired):
+		return StatusLoginRequired
+	}
+	//bare 401 or 403 may be an anti-bot or guest check that goes away, only the extractor tells login is required
+	return StatusFailing
+}
+
+//failure that does not go away by retry, the refresh request is acked
+func permanentStatus(status string) bool {
+	return status == StatusNotFound || status == StatusLoginRequired
+}
+
+//save status of a failed crawl, history is deleted after maxFailures permanent failures in a row.
+//return whether history is deleted
+func markFailure(ctx context.Context, col *mongo.Collection, id primitive.ObjectID, status string, maxFailures int) (deleted bool, err error) {
+	update := bson.M{"$set": bson.M{"status": status}}
+	if !permanentStatus(status) {
+		_, err = col.UpdateOne(ctx, bson.M{"_id": id}, update)
+		return false, err
+	}
+	update["$inc"] = bson.M{"fail_count": 1}
+	history := History{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"fail_count": 1, "delete": 1})
+	err = col.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&history)
+	if err != nil {
+		return false, err
+	}
+	if history.Delete || maxFailures <= 0 || history.FailCount < maxFailures {
+		return history.Delete, nil
+	}
+	_, err = col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"delete": true}})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlStatus(t *testing.T) {
+	cases := []struct {
+		info       postInformation
+		httpStatus int
+		err        error
+		status     string
+	}{
+		{postInformation{TotalPage: 1}, http.StatusOK, nil, StatusOK},
+		{postInformation{TotalPage: 1, Locked: true}, http.StatusOK, nil, StatusLocked},
+		{postInformation{}, http.StatusOK, fmt.Errorf("%w: (ERROR:15)帖子被设为隐藏", ErrThreadDeleted), StatusNotFound},
+		{postInformation{}, http.StatusNotFound, missingField("v2ex", "title"), StatusNotFound},
+		{postInformation{}, http.StatusOK, ErrLoginRequired, StatusLoginRequired},
+		{postInformation{}, http.StatusForbidden, missingField("zhihu", "answer count"), StatusFailing},
+		{postInformation{}, http.StatusUnauthorized, missingField("nga", "title"), StatusFailing},
+		{postInformation{}, http.StatusForbidden, ErrLoginRequired, StatusLoginRequired},
+		{postInformation{}, http.StatusOK, missingField("tieba", "title"), StatusFailing},
+		{postInformation{}, http.StatusServiceUnavailable, missingField("tieba", "title"), StatusFailing},
+		{postInformation{}, 0, errors.New("dial tcp: i/o timeout"), StatusFailing},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.status, crawlStatus(c.info, c.httpStatus, c.err), c.err)
+	}
+	assert.True(t, permanentStatus(StatusNotFound))
+	assert.True(t, permanentStatus(StatusLoginRequired))
+	assert.False(t, permanentStatus(StatusFailing))
+	assert.False(t, permanentStatus(StatusLocked))
+}
+
+func TestExtractorStatusErrors(t *testing.T) {
+	ast := assert.New(t)
+	_, err := ngaExtractor(`<title>NGA玩家社区</title><!--msginfostart-->(ERROR:1)你需要登录后才能查看此版面<!--msginfoend-->`)
+	ast.ErrorIs(err, ErrLoginRequired)
+	_, err = bilibili{}.Parse(`{"code":-404,"message":"啥都木有","ttl":1}`)
+	ast.ErrorIs(err, ErrThreadDeleted)
+	_, err = bilibili{}.Parse(fixture(t, "bilibili_error.json"))
+	ast.Equal(StatusFailing, crawlStatus(postInformation{}, http.StatusOK, err))
+}
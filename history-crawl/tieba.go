@@ -2,64 +2,86 @@ package main
 
 import (
 	"context"
-	"errors"
 	"net/http"
+	"net/url"
 	"regexp"
-	"strconv"
+	"strings"
+
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
 )
 
-func tiebaPostRequest(client *http.Client, crawlUrl string) (*http.Request, error) {
-	req, err := http.NewRequest("GET", crawlUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-	return req, nil
+func init() {
+	Register(tieba{})
 }
 
-func tiebaExtractor(text string) (info postInformation, err error) {
-	totalPageRegex := regexp.MustCompile(`"total_page":(\d+)`)
-	titleRegex := regexp.MustCompile(`title:.?"(.+?)"`)
+type tieba struct{}
 
-	totalPageRaw := totalPageRegex.FindStringSubmatch(text)
-	if len(totalPageRaw) < 2 {
-		return info, errors.New("can not find total page")
-	}
-	totalPage, err := strconv.Atoi(totalPageRaw[1])
+var tiebaPath = regexp.MustCompile(`^/p/\d+$`)
+
+//notice of deleted and locked thread, only searched in its own element since a reply may quote it
+const (
+	tiebaDeletedText = "该贴已被删除"
+	tiebaLockedText  = "该贴已被锁定"
+)
+
+func (tieba) Type() string {
+	return "tieba"
+}
+
+func (tieba) Match(u *url.URL) bool {
+	return u.Hostname() == "tieba.baidu.com" && tiebaPath.MatchString(u.Path)
+}
+
+func (tieba) Request(ctx context.Context, client *crawlclient.Client, crawlUrl string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", crawlUrl, nil)
+}
+
+func (tieba) Parse(page string) (postInformation, error) {
+	return tiebaExtractor(page)
+}
+
+func tiebaExtractor(text string) (info postInformation, err error) {
+	doc, err := parseDocument(text)
 	if err != nil {
-		return info, errors.New("can not find total page")
+		return info, err
+	}
+	if strings.Contains(selectText(doc, "title"), "贴吧404") || strings.Contains(selectText(doc, "#errorText"), tiebaDeletedText) {
+		return info, ErrThreadDeleted
+	}
+	pager := struct {
+		TotalPage int `json:"total_page"`
+	}{}
+	if err := embeddedJSON(text, "PageData.pager", &pager); err != nil || pager.TotalPage == 0 {
+		return info, missingField("tieba", "total page")
+	}
+	totalPage := pager.TotalPage
+	user, _ := embeddedObject(text, "PageData.user")
+	if login, _ := jsValue(user, "is_login"); login != "1" && login != "true" {
+		totalPage = (totalPage + 1) / 2 //登录后每页贴数翻倍, page of guest is converted to page of logged in user, rounded up
 	}
-	totalPage = totalPage / 2 //登录后每页贴数翻倍
 
-	titleRaw := titleRegex.FindStringSubmatch(text)
-	if len(totalPageRaw) < 2 {
-		return info, errors.New("can not find title")
+	//thread is a javascript object, title of the page is used if not found
+	thread, _ := embeddedObject(text, "PageData.thread")
+	title, _ := jsValue(thread, "title")
+	if title == "" {
+		title = selectAttr(doc, ".core_title_txt", "title")
 	}
-	title := titleRaw[1]
-	if string([]rune(title)[:3]) == "回复：" {
-		title = string([]rune(title)[3:])
+	if title == "" {
+		title = strings.SplitN(selectText(doc, "title"), "_", 2)[0]
+	}
+	title = strings.TrimPrefix(title, "回复：")
+	if title == "" {
+		return info, missingField("tieba", "title")
 	}
 
 	info.TotalPage = totalPage
 	info.Title = title
-	return info, err
+	info.Author, _ = jsValue(thread, "author")
+	info.ReplyCount, _ = jsInt(thread, "reply_num")
+	info.Locked = strings.Contains(selectText(doc, ".pb_thread_notice"), tiebaLockedText)
+	return info, nil
 }
 
-func tiebaProc(ctx context.Context, history *History) error {
-	page, err := crawlPage(history.Url, tiebaPostRequest)
-	if err != nil {
-		return err
-	}
-	info, err := tiebaExtractor(page)
-	if info.Title == "" && info.TotalPage == 0 {
-		logger.Error("get tieba info fail", "crawl page", page, "history", history)
-		return errors.New("get info fail")
-	} else if info.Title == "" || info.TotalPage == 0 {
-		logger.Warn("fail get all tieba data", "crawl page", page, "history", history)
-	}
-	if err != nil {
-		return err
-	}
-	history.Title = info.Title
-	history.TotalPage = info.TotalPage
-	return nil
+func (tieba) PageUrl(crawlUrl string, page int) string {
+	return setPageQuery(crawlUrl, "pn", page)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
 	"github.com/lyineee/go-learn/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -14,8 +15,10 @@ func TestTiebaExtractor(t *testing.T) {
 	info, err := tiebaExtractor(text)
 	ast.Equal(nil, err)
 	ast.Equal(postInformation{
-		Title:     "【安科漫画】魔物训使",
-		TotalPage: 35,
+		Title:      "【安科漫画】魔物训使",
+		TotalPage:  35,
+		ReplyCount: 1824,
+		Author:     "地底的月亮",
 	}, info)
 }
 
@@ -26,7 +29,7 @@ func TestTiebaProc(t *testing.T) {
 	his := History{
 		Url: "https://tieba.baidu.com/p/7278674944?pn=2",
 	}
-	err := tiebaProc(ctx, &his)
+	_, _, err := extract(ctx, crawlclient.New(crawlclient.DefaultConfig()), tieba{}, &his)
 	ast.Equal(nil, err)
 	if ast.Equal(his.Title, "【安科漫画】魔物训使") && ast.Equal(35, his.TotalPage) {
 		t.Log(his)
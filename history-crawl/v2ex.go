@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
+)
+
+func init() {
+	Register(v2ex{})
+}
+
+type v2ex struct{}
+
+var (
+	v2exPath  = regexp.MustCompile(`^/t/\d+$`)
+	v2exReply = regexp.MustCompile(`(\d+) 条回复`)
+)
+
+func (v2ex) Type() string {
+	return "v2ex"
+}
+
+func (v2ex) Match(u *url.URL) bool {
+	switch u.Hostname() {
+	case "www.v2ex.com", "v2ex.com":
+		return v2exPath.MatchString(u.Path)
+	}
+	return false
+}
+
+func (v2ex) Request(ctx context.Context, client *crawlclient.Client, crawlUrl string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", crawlUrl, nil)
+}
+
+//100 replies per page, no pager if only one page
+func (v2ex) Parse(page string) (info postInformation, err error) {
+	doc, err := parseDocument(page)
+	if err != nil {
+		return info, err
+	}
+	info.Title = selectText(doc, ".header h1")
+	if info.Title == "" {
+		info.Title = strings.TrimSuffix(selectText(doc, "title"), " - V2EX")
+	}
+	if info.Title == "" {
+		return info, missingField("v2ex", "title")
+	}
+	info.TotalPage = 1
+	if max := selectAttr(doc, "input.page_input", "max"); max != "" {
+		info.TotalPage, err = strconv.Atoi(max)
+		if err != nil {
+			return info, missingField("v2ex", "total page")
+		}
+	}
+	info.Author = selectText(doc, ".header small.gray a[href^='/member/']")
+	doc.Find(".cell span.gray").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if reply := v2exReply.FindStringSubmatch(s.Text()); len(reply) == 2 {
+			info.ReplyCount, _ = strconv.Atoi(reply[1])
+			return false
+		}
+		return true
+	})
+	if replyTime, _ := doc.Find("span.ago").Last().Attr("title"); replyTime != "" && info.ReplyCount != 0 { //topic time if no reply
+		info.LastReplyAt, _ = time.Parse("2006-01-02 15:04:05 -07:00", replyTime)
+	}
+	return info, nil
+}
+
+//replies of the crawled page, the topic itself is not included
+func (v2ex) Posts(page string) ([]Post, error) {
+	doc, err := parseDocument(page)
+	if err != nil {
+		return nil, err
+	}
+	posts := []Post{}
+	doc.Find("div.cell[id^='r_']").Each(func(i int, cell *goquery.Selection) {
+		post := Post{Floor: i + 1}
+		if no, err := strconv.Atoi(strings.TrimSpace(cell.Find("span.no").Text())); err == nil {
+			post.Floor = no
+		}
+		post.Author = strings.TrimSpace(cell.Find("strong a[href^='/member/']").First().Text())
+		if replyTime, ok := cell.Find("span.ago").Attr("title"); ok {
+			post.Time, _ = time.Parse("2006-01-02 15:04:05 -07:00", replyTime)
+		}
+		if content := cell.Find(".reply_content"); content.Length() != 0 {
+			post.Content = strings.TrimSpace(content.Text())
+		} else {
+			cell.Find("span.ago").Remove()
+			post.Content = strings.TrimSpace(cell.Text())
+		}
+		posts = append(posts, post)
+	})
+	return posts, nil
+}
+
+func (v2ex) PageUrl(crawlUrl string, page int) string {
+	return setPageQuery(crawlUrl, "p", page)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestV2exExtractor(t *testing.T) {
+	ast := assert.New(t)
+	info, err := v2ex{}.Parse(fixture(t, "v2ex.html"))
+	ast.Equal(nil, err)
+	ast.Equal("有没有好用的 Redis Stream 管理工具？", info.Title)
+	ast.Equal(3, info.TotalPage)
+	ast.Equal(253, info.ReplyCount)
+	ast.Equal("lyine", info.Author)
+	ast.True(time.Date(2022, 2, 15, 12, 31, 9, 0, chinaTime).Equal(info.LastReplyAt))
+
+	text := `<head><title>单页的主题 &amp; 没有分页 - V2EX</title></head><div class="cell">no pager</div>`
+	info, err = v2ex{}.Parse(text)
+	ast.Equal(nil, err)
+	ast.Equal(postInformation{
+		Title:     "单页的主题 & 没有分页",
+		TotalPage: 1,
+	}, info)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lyineee/go-learn/history-crawl/crawlclient"
+)
+
+func init() {
+	Register(zhihu{})
+}
+
+type zhihu struct{}
+
+var zhihuPath = regexp.MustCompile(`^/question/(\d+)/?$`)
+
+//answers are not paged on the question page, page size of the answer api is used
+const zhihuAnswerPageSize = 20
+
+func (zhihu) Type() string {
+	return "zhihu"
+}
+
+func (zhihu) Match(u *url.URL) bool {
+	return u.Hostname() == "www.zhihu.com" && zhihuPath.MatchString(u.Path)
+}
+
+func (zhihu) Request(ctx context.Context, client *crawlclient.Client, crawlUrl string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", crawlUrl, nil)
+}
+
+//question in js-initialData
+type zhihuQuestion struct {
+	Title       string `json:"title"`
+	AnswerCount *int   `json:"answerCount"`
+	UpdatedTime int64  `json:"updatedTime"`
+	Author      struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+//question id is unknown without the url, question is picked by page title
+func (z zhihu) Parse(page string) (postInformation, error) {
+	return z.ParseURL("", page)
+}
+
+//total page is the page count of answers
+func (zhihu) ParseURL(crawlUrl, page string) (info postInformation, err error) {
+	doc, err := parseDocument(page)
+	if err != nil {
+		return info, err
+	}
+	initialData := struct {
+		InitialState struct {
+			Entities struct {
+				Questions map[string]zhihuQuestion `json:"questions"`
+			} `json:"entities"`
+		} `json:"initialState"`
+	}{}
+	//not found in the page of captcha
+	if data := doc.Find("script#js-initialData").Text(); data != "" {
+		if err := json.Unmarshal([]byte(data), &initialData); err != nil {
+			return info, fmt.Errorf("unmarshal zhihu initial data: %w", err)
+		}
+	}
+	pageTitle := strings.TrimSuffix(selectText(doc, "title"), " - 知乎")
+	question := pickZhihuQuestion(initialData.InitialState.Entities.Questions, zhihuQuestionID(crawlUrl), pageTitle)
+	if question == nil || question.AnswerCount == nil {
+		return info, missingField("zhihu", "answer count")
+	}
+	info.Title = question.Title
+	if info.Title == "" {
+		info.Title = pageTitle
+	}
+	if info.Title == "" {
+		return info, missingField("zhihu", "title")
+	}
+	info.ReplyCount = *question.AnswerCount
+	info.TotalPage = (info.ReplyCount + zhihuAnswerPageSize - 1) / zhihuAnswerPageSize
+	if info.TotalPage == 0 {
+		info.TotalPage = 1
+	}
+	info.Author = question.Author.Name
+	if question.UpdatedTime != 0 {
+		info.LastReplyAt = time.Unix(question.UpdatedTime, 0)
+	}
+	return info, nil
+}
+
+func zhihuQuestionID(crawlUrl string) string {
+	u, err := url.Parse(crawlUrl)
+	if err != nil {
+		return ""
+	}
+	match := zhihuPath.FindStringSubmatch(u.Path)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+//related questions may be included in initial data, question is picked by id,
+//or by page title if id is unknown, or the only one
+func pickZhihuQuestion(questions map[string]zhihuQuestion, id, pageTitle string) *zhihuQuestion {
+	if id != "" {
+		if q, ok := questions[id]; ok {
+			return &q
+		}
+		return nil
+	}
+	for _, q := range questions {
+		if q.Title == pageTitle {
+			return &q
+		}
+	}
+	if len(questions) == 1 {
+		for _, q := range questions {
+			return &q
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZhihuExtractor(t *testing.T) {
+	ast := assert.New(t)
+	info, err := zhihu{}.Parse(fixture(t, "zhihu.html"))
+	ast.Equal(nil, err)
+	ast.Equal(postInformation{
+		Title:       "如何评价 Go 1.18 的泛型？",
+		TotalPage:   7,
+		ReplyCount:  128,
+		Author:      "地鼠",
+		LastReplyAt: time.Unix(1647561600, 0),
+	}, info)
+	urlInfo, err := zhihu{}.ParseURL("https://www.zhihu.com/question/19550225", fixture(t, "zhihu.html"))
+	ast.Nil(err)
+	ast.Equal(info, urlInfo)
+
+	_, err = zhihu{}.Parse(`<title data-rh="true">安全验证 - 知乎</title>`)
+	ast.NotNil(err)
+}
+
+//related question in initial data is never picked
+func TestZhihuQuestion(t *testing.T) {
+	ast := assert.New(t)
+	page := `<title>related - 知乎</title><script id="js-initialData" type="text/json">{"initialState":{"entities":{"questions":{
+		"1":{"title":"question","answerCount":20},
+		"2":{"title":"related","answerCount":21}}}}}</script>`
+	for i := 0; i < 10; i++ { //map order is random
+		info, err := zhihu{}.ParseURL("https://www.zhihu.com/question/1", page)
+		ast.Nil(err)
+		ast.Equal(postInformation{Title: "question", TotalPage: 1, ReplyCount: 20}, info)
+	}
+	_, err := zhihu{}.ParseURL("https://www.zhihu.com/question/3", page)
+	ast.NotNil(err)
+	info, err := zhihu{}.Parse(page) //picked by title without url
+	ast.Nil(err)
+	ast.Equal(postInformation{Title: "related", TotalPage: 2, ReplyCount: 21}, info)
+
+	ast.Equal("19550225", zhihuQuestionID("https://www.zhihu.com/question/19550225/"))
+	ast.Equal("", zhihuQuestionID("https://www.zhihu.com/people/x"))
+}
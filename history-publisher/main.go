@@ -2,43 +2,63 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/lyineee/go-learn/utils/log"
 	_ "github.com/lyineee/go-learn/utils/remote"
 	"github.com/spf13/viper"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	rsmessage "github.com/lyineee/go-learn/redis-stream/message"
 )
 
 type RedisQueueOptions struct {
 	Group  string
 	Stream string
 }
-type RedisStreamMessage struct {
-	ID        string
-	MongoDBId string
-}
 type History struct {
 	Id        primitive.ObjectID `bson:"_id,omitempty"`
 	Url       string             `bson:"url,omitempty"`
 	Type      string             `bson:"type,omitempty"`
 	TotalPage int                `bson:"total_page,omitempty"`
 	Title     string             `bson:"title,omitempty"`
+	Delete    bool               `bson:"delete,omitempty"`
+	Owner     primitive.ObjectID `bson:"owner,omitempty"`
+
+	OwnerAccount *User `bson:"owner_account,omitempty"` //joined from userCol, not saved
+
+	NextRefreshAt      time.Time     `bson:"next_refresh_at,omitempty"`
+	RefreshInterval    time.Duration `bson:"refresh_interval,omitempty"`
+	Priority           int           `bson:"priority,omitempty"`             //higher is hotter
+	ScheduledTotalPage int           `bson:"scheduled_total_page,omitempty"` //total page when last scheduled
 }
 
 var logger *log.SugarLogger
 
 var historyDatabase string = "site"
 var historyCol string = "history"
+var userCol string = "user"
 var logSubject string = "go-learn.history-publisher"
 
 func main() {
+	cmd, err := parseFlags(os.Args[1:], time.Now(), os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	// get envirment
 	viper.AutomaticEnv()
 
@@ -52,6 +72,23 @@ func main() {
 
 	//redis stream
 	viper.SetDefault("log.subject", logSubject)
+	viper.SetDefault("log.max_len", 100000)
+	viper.SetDefault("stream.max_age", "72h")     //refresh request older than 72h is dropped
+	viper.SetDefault("stream.pending_ttl", "72h") //skip history with a pending refresh in ttl
+
+	//once publishes all history and exit, watch publishes new history by mongodb change stream until stopped
+	viper.SetDefault("mode", "once")
+	viper.SetDefault("watch.resume_key", defaultResumeTokenKey)
+
+	//refresh interval of each history adapts to its activity, once mode publishes only due history
+	viper.SetDefault("schedule.min_interval", "15m") //keep schedule.min_interval of history-crawl the same
+	viper.SetDefault("schedule.max_interval", "168h")
+	viper.SetDefault("schedule.initial_interval", "1h")
+	viper.SetDefault("owner.default_quota", 0) //histories of one owner refreshed per cycle, 0 is unlimited
+
+	//due history is read by cursor and published in pipelined batches, an interrupted run resumes after the last batch
+	viper.SetDefault("publish.batch_size", 100)
+	viper.SetDefault("publish.resume_key", defaultResumeIdKey)
 
 	log.Info("default config", log.Any("config", viper.AllSettings()))
 
@@ -88,6 +125,7 @@ func main() {
 
 		log.Info("using redis log stream", log.String("log_stream", logStream), log.String("log_subject", subject))
 		w := log.NewRedisWriterWithAddress(viper.GetString("database.redis"), "", logStream, subject)
+		w.SetRetention(viper.GetInt64("log.max_len"), viper.GetDuration("log.max_age"))
 		logger = log.NewLogger(log.NewJsonCore(w), log.InfoLevel).Sugar()
 	}
 	defer logger.Sync()
@@ -110,64 +148,106 @@ func main() {
 
 	redisQueueOptions := RedisQueueOptions{
 		Group:  "backend.history.refresh.workers",
-		Stream: "backend.history.refresh",
+		Stream: rsmessage.RefreshStream,
+	}
+	if cmd.stream != "" {
+		redisQueueOptions.Stream = cmd.stream
 	}
 	//TODO create group worker
 	err = createGroup(ctx, rdb, redisQueueOptions)
 	if err != nil {
 		logger.Errorw("create group fail", "queue_options", redisQueueOptions, "error", err)
 	}
-
-	//TODO clean up stream pending list
+	stream := rstream.RedisStream{}
+	stream.New(&rstream.StreamConfig{
+		Client: rdb,
+		Stream: redisQueueOptions.Stream,
+		Retention: rstream.Retention{
+			MaxLen: viper.GetInt64("stream.max_len"),
+			MaxAge: viper.GetDuration("stream.max_age"),
+		},
+	})
 
 	historyCol := mongoClient.Database(historyDatabase).Collection(historyCol)
-	historys, err := getAllHistory(ctx, historyCol)
-	if err != nil {
-		logger.Errorw("get history from mongodb error", "error", err) //TODO add handler
-	}
-	for _, history := range historys {
-		//TODO check if stream exist
-		err = addIdToStream(ctx, rdb, redisQueueOptions, history)
-		logger.Infow(fmt.Sprintf("add history %s to stream", history.Id.Hex()), "history", history)
-		if err != nil {
-			logger.Errorw("add history to stream error", "redis_options", redisQueueOptions, "history", history, "error", err)
+	userCol := mongoClient.Database(historyDatabase).Collection(userCol)
+	if cmd.url != "" {
+		if err := checkURLRegex(ctx, historyCol, cmd.url); err != nil {
+			logger.Fatalw("invalid url regex", "url", cmd.url, "error", err)
 		}
 	}
-}
-
-func getAllHistory(ctx context.Context, col *mongo.Collection) (historys []History, err error) {
-	//TODO validate owner account status
-	filter := bson.M{"$or": bson.A{bson.M{"delete": false}, bson.M{"delete": bson.M{"$exists": false}}}}
-	cur, err := col.Find(ctx, filter)
-	if err != nil {
+	pendingPrefix := rsmessage.RefreshPendingPrefix
+	if cmd.stream != "" {
+		//pending refresh of another stream must not block the refresh stream
+		pendingPrefix = cmd.stream + ".pending"
+	}
+	pending := rstream.NewDedup(rdb, pendingPrefix, viper.GetDuration("stream.pending_ttl"))
+	scheduleConfig := ScheduleConfig{}
+	if err := viper.UnmarshalKey("schedule", &scheduleConfig); err != nil {
+		logger.Fatalw("invalid schedule config", "error", err)
+	}
+	ctxSignal, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	//selectors, dry run and test stream always run once
+	if viper.GetString("mode") == "watch" && cmd.selector.empty() && !cmd.dryRun && cmd.stream == "" {
+		watcher := historyWatcher{
+			col:      historyCol,
+			stream:   &stream,
+			pending:  pending,
+			tokens:   resumeTokens{rdb: rdb, key: viper.GetString("watch.resume_key")},
+			schedule: scheduleConfig,
+			users:    userCol,
+		}
+		err = watcher.run(ctxSignal)
+		logger.Infow("graceful shutdown", "reason", err)
 		return
 	}
-	err = cur.All(ctx, &historys)
-	if err != nil {
-		logger.Errorw("get history error", "error", err) //TODO add error handler
+	ownerConfig := OwnerConfig{}
+	if err := viper.UnmarshalKey("owner", &ownerConfig); err != nil {
+		logger.Fatalw("invalid owner config", "error", err)
 	}
-	return
-}
-
-func addIdToStream(ctx context.Context, rdb *redis.Client, options RedisQueueOptions, history History) error {
-	// for _, history := range historys {
-	result, err := rdb.XAdd(ctx, &redis.XAddArgs{
-		Stream:     options.Stream,
-		NoMkStream: false,
-		ID:         "*",
-		Values: map[string]interface{}{
-			"id": history.Id.Hex(),
-		},
-	}).Result()
+	now := time.Now()
+	resumeKey := viper.GetString("publish.resume_key")
+	//resume id of a partial or test run must not be used by the next full run
+	if !cmd.selector.empty() || cmd.dryRun || cmd.stream != "" {
+		resumeKey = ""
+	}
+	p := publisher{
+		col:       historyCol,
+		stream:    &stream,
+		pending:   pending,
+		schedule:  scheduleConfig,
+		quota:     newOwnerQuota(ownerConfig),
+		resume:    resumeIds{rdb: rdb, key: resumeKey},
+		batchSize: viper.GetInt("publish.batch_size"),
+		now:       now,
+		//schedule is only moved by the refresh stream
+		keepSchedule: cmd.stream != "",
+	}
+	if cmd.dryRun {
+		p.dryRun = os.Stdout
+	}
+	err = p.run(ctxSignal, historyFilter(now, cmd.selector))
 	if err != nil {
-		logger.Error("add to stream error", "error", err) //TODO add error handler
+		logger.Errorw("publish history error, resume in next run", "error", err)
 	}
-	if result == "0" { //TODO validate result value
-		logger.Warnw("result is 0")
+	total := p.summary.log()
+	if !cmd.dryRun {
+		//connect ctx may be expired by a long run
+		ctxTrim, cancelTrim := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancelTrim()
+		if _, err := stream.Trim(ctxTrim); err != nil {
+			logger.Errorw("trim stream error", "redis_options", redisQueueOptions, "error", err)
+		}
 	}
-	// }
-	return nil
+	if err != nil || total.Failed != 0 {
+		logger.Sync()
+		os.Exit(1)
+	}
+}
 
+//return empty id if the history already has a pending refresh
+func addIdToStream(ctx context.Context, stream *rstream.RedisStream, pending *rstream.Dedup, history History) (string, error) {
+	return rstream.PublishOnce(ctx, stream, pending, history.Id.Hex(), rsmessage.RefreshRequest{HistoryID: history.Id.Hex(), Priority: history.Priority})
 }
 
 func createGroup(ctx context.Context, rdb *redis.Client, options RedisQueueOptions) error {
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+//account owning histories, in userCol of historyDatabase
+type User struct {
+	Id       primitive.ObjectID `bson:"_id,omitempty"`
+	Name     string             `bson:"name,omitempty"`
+	Disabled bool               `bson:"disabled,omitempty"`
+	ExpireAt time.Time          `bson:"expire_at,omitempty"` //never expires if not set
+	Quota    int                `bson:"quota,omitempty"`     //histories refreshed per cycle, default quota if not set
+}
+
+//reason a due history is not published
+const (
+	SkipNoAccount = "no_account" //owner not found in users collection
+	SkipDisabled  = "disabled"
+	SkipExpired   = "expired"
+	SkipQuota     = "quota" //owner reached quota of this cycle, history is still due in next cycle. only published history uses quota
+	SkipPending   = "pending"
+)
+
+type OwnerConfig struct {
+	DefaultQuota int `mapstructure:"default_quota"` //0 is unlimited
+}
+
+//account status of the owner, empty if history can be published
+func accountStatus(user *User, now time.Time) string {
+	switch {
+	case user == nil:
+		return SkipNoAccount
+	case user.Disabled:
+		return SkipDisabled
+	case !user.ExpireAt.IsZero() && !user.ExpireAt.After(now):
+		return SkipExpired
+	}
+	return ""
+}
+
+//per owner quota of one publish cycle, history without owner shares the default quota
+type ownerQuota struct {
+	config OwnerConfig
+	used   map[primitive.ObjectID]int
+}
+
+func newOwnerQuota(config OwnerConfig) *ownerQuota {
+	return &ownerQuota{config: config, used: map[primitive.ObjectID]int{}}
+}
+
+//check owner account of history and take one from quota, return skip reason
+func (q *ownerQuota) take(history History, now time.Time) string {
+	quota := q.config.DefaultQuota
+	if !history.Owner.IsZero() {
+		if status := accountStatus(history.OwnerAccount, now); status != "" {
+			return status
+		}
+		if history.OwnerAccount.Quota != 0 {
+			quota = history.OwnerAccount.Quota
+		}
+	}
+	if quota > 0 && q.used[history.Owner] >= quota {
+		return SkipQuota
+	}
+	q.used[history.Owner]++
+	return ""
+}
+
+//give back quota taken by history not published, e.g. skipped as pending
+func (q *ownerQuota) refund(history History) {
+	if q.used[history.Owner] > 0 {
+		q.used[history.Owner]--
+	}
+}
+
+//join owner account of history, owner_account is missing if history has no owner or owner is not found
+func lookupOwner() bson.D {
+	return bson.D{{Key: "$lookup", Value: bson.M{
+		"from":         userCol,
+		"localField":   "owner",
+		"foreignField": "_id",
+		"as":           "owner_account",
+	}}}
+}
+
+func unwindOwner() bson.D {
+	return bson.D{{Key: "$unwind", Value: bson.M{"path": "$owner_account", "preserveNullAndEmptyArrays": true}}}
+}
+
+//owner account of one history, nil if not found
+func findOwner(ctx context.Context, col *mongo.Collection, owner primitive.ObjectID) (*User, error) {
+	user := User{}
+	err := col.FindOne(ctx, bson.M{"_id": owner}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+//result of one owner in a publish cycle
+type ownerSummary struct {
+	Published int            `json:"published"`
+	Failed    int            `json:"failed"`
+	Skipped   map[string]int `json:"skipped,omitempty"` //count by skip reason
+}
+
+//results of a publish cycle by owner id in hex, "" for history without owner
+type runSummary map[string]*ownerSummary
+
+func (s runSummary) owner(history History) *ownerSummary {
+	owner := ""
+	if !history.Owner.IsZero() {
+		owner = history.Owner.Hex()
+	}
+	summary, ok := s[owner]
+	if !ok {
+		summary = &ownerSummary{Skipped: map[string]int{}}
+		s[owner] = summary
+	}
+	return summary
+}
+
+func (s runSummary) published(history History) { s.owner(history).Published++ }
+func (s runSummary) failed(history History)    { s.owner(history).Failed++ }
+func (s runSummary) skipped(history History, reason string) {
+	s.owner(history).Skipped[reason]++
+}
+
+//counts of all owners
+func (s runSummary) total() ownerSummary {
+	total := ownerSummary{Skipped: map[string]int{}}
+	for _, summary := range s {
+		total.Published += summary.Published
+		total.Failed += summary.Failed
+		for reason, n := range summary.Skipped {
+			total.Skipped[reason] += n
+		}
+	}
+	return total
+}
+
+//log summary of each owner and the total, return the total
+func (s runSummary) log() ownerSummary {
+	for owner, summary := range s {
+		logger.Infow(fmt.Sprintf("owner %q published %d, failed %d", owner, summary.Published, summary.Failed), "owner", owner, "summary", summary)
+	}
+	total := s.total()
+	skipped := 0
+	for _, n := range total.Skipped {
+		skipped += n
+	}
+	logger.Infow(fmt.Sprintf("published %d, skipped %d, failed %d", total.Published, skipped, total.Failed), "summary", total, "owners", len(s))
+	return total
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAccountStatus(t *testing.T) {
+	ast := assert.New(t)
+	now := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	ast.Equal(SkipNoAccount, accountStatus(nil, now))
+	ast.Equal(SkipDisabled, accountStatus(&User{Disabled: true}, now))
+	ast.Equal(SkipExpired, accountStatus(&User{ExpireAt: now}, now))
+	ast.Equal("", accountStatus(&User{ExpireAt: now.Add(time.Hour)}, now))
+	ast.Equal("", accountStatus(&User{}, now))
+}
+
+func TestOwnerQuota(t *testing.T) {
+	ast := assert.New(t)
+	now := time.Now()
+	quota := newOwnerQuota(OwnerConfig{DefaultQuota: 2})
+	limited := History{Owner: primitive.NewObjectID(), OwnerAccount: &User{}}
+	vip := History{Owner: primitive.NewObjectID(), OwnerAccount: &User{Quota: 3}}
+	for i := 0; i < 2; i++ {
+		ast.Equal("", quota.take(limited, now))
+		ast.Equal("", quota.take(History{}, now))
+	}
+	ast.Equal(SkipQuota, quota.take(limited, now))
+	ast.Equal(SkipQuota, quota.take(History{}, now))
+	for i := 0; i < 3; i++ {
+		ast.Equal("", quota.take(vip, now))
+	}
+	ast.Equal(SkipQuota, quota.take(vip, now))
+	ast.Equal(SkipNoAccount, quota.take(History{Owner: primitive.NewObjectID()}, now))
+	ast.Equal(SkipDisabled, quota.take(History{Owner: primitive.NewObjectID(), OwnerAccount: &User{Disabled: true}}, now))
+
+	quota.refund(vip)
+	ast.Equal("", quota.take(vip, now))
+	ast.Equal(SkipQuota, quota.take(vip, now))
+	quota.refund(History{Owner: primitive.NewObjectID()}) //nothing taken
+
+	unlimited := newOwnerQuota(OwnerConfig{})
+	for i := 0; i < 10; i++ {
+		ast.Equal("", unlimited.take(limited, now))
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	ast := assert.New(t)
+	owned := History{Owner: primitive.NewObjectID()}
+	summary := runSummary{}
+	summary.published(owned)
+	summary.failed(owned)
+	summary.skipped(owned, SkipQuota)
+	summary.skipped(History{}, SkipPending)
+	ast.Equal(&ownerSummary{Published: 1, Failed: 1, Skipped: map[string]int{SkipQuota: 1}}, summary[owned.Owner.Hex()])
+	ast.Equal(&ownerSummary{Skipped: map[string]int{SkipPending: 1}}, summary[""])
+}
+
+func TestRunSummaryTotal(t *testing.T) {
+	ast := assert.New(t)
+	summary := runSummary{}
+	summary.published(History{Owner: primitive.NewObjectID()})
+	summary.skipped(History{Owner: primitive.NewObjectID()}, SkipQuota)
+	summary.skipped(History{}, SkipQuota)
+	summary.failed(History{})
+	ast.Equal(ownerSummary{Published: 1, Failed: 1, Skipped: map[string]int{SkipQuota: 2}}, summary.total())
+}
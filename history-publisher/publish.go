@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	rsmessage "github.com/lyineee/go-learn/redis-stream/message"
+)
+
+//last processed history id of an interrupted run
+const defaultResumeIdKey = "history-publisher.resume_id"
+
+//id of the last history in a flushed batch, kept in redis until the run completes.
+//resume is off if key is empty
+type resumeIds struct {
+	rdb *redis.Client
+	key string
+}
+
+//zero id if not saved
+func (ids resumeIds) load(ctx context.Context) (primitive.ObjectID, error) {
+	if ids.key == "" {
+		return primitive.NilObjectID, nil
+	}
+	hex, err := ids.rdb.Get(ctx, ids.key).Result()
+	if err == redis.Nil {
+		return primitive.NilObjectID, nil
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return primitive.ObjectIDFromHex(hex)
+}
+
+func (ids resumeIds) save(ctx context.Context, id primitive.ObjectID) error {
+	if ids.key == "" {
+		return nil
+	}
+	return ids.rdb.Set(ctx, ids.key, id.Hex(), 0).Err()
+}
+
+func (ids resumeIds) reset(ctx context.Context) error {
+	if ids.key == "" {
+		return nil
+	}
+	return ids.rdb.Del(ctx, ids.key).Err()
+}
+
+//publish refresh request of history matching filter in batches
+type publisher struct {
+	col          *mongo.Collection
+	stream       *rstream.RedisStream
+	pending      *rstream.Dedup
+	schedule     ScheduleConfig
+	quota        *ownerQuota
+	resume       resumeIds
+	batchSize    int
+	now          time.Time //time of this cycle
+	dryRun       io.Writer //print history instead of publishing if set, nothing is saved
+	keepSchedule bool      //publish without saving schedule, set for a test stream
+
+	summary runSummary
+	batch   []History
+	next    []schedule
+}
+
+//error is returned when mongodb or redis fails, failure of single history is counted in summary.
+//resume id is kept for the next run if error is returned
+func (p *publisher) run(ctx context.Context, filter bson.M) error {
+	if p.summary == nil {
+		p.summary = runSummary{}
+	}
+	after, err := p.resume.load(ctx)
+	if err != nil {
+		return fmt.Errorf("load resume id: %w", err)
+	}
+	if !after.IsZero() {
+		logger.Infow(fmt.Sprintf("resume after history %s", after.Hex()), "resume_id", after.Hex())
+	}
+	cur, err := historyCursor(ctx, p.col, filter, after, int32(p.batchSize))
+	if err != nil {
+		return fmt.Errorf("find history: %w", err)
+	}
+	defer cur.Close(context.Background())
+	for cur.Next(ctx) {
+		history := History{}
+		if err := cur.Decode(&history); err != nil {
+			logger.Errorw("decode history error", "history", cur.Current.String(), "error", err)
+			p.summary.failed(history)
+			continue
+		}
+		//pending history is skipped before taking quota, or it would use quota of other history of the owner
+		pending, err := p.pending.Claimed(ctx, history.Id.Hex())
+		if err != nil {
+			return fmt.Errorf("check pending refresh: %w", err)
+		}
+		if pending[0] {
+			logger.Infow(fmt.Sprintf("skip history %s with pending refresh", history.Id.Hex()), "history", history)
+			p.summary.skipped(history, SkipPending)
+			if p.dryRun != nil {
+				history.Priority = p.schedule.next(history, p.now).Priority
+				p.printDryRun(SkipPending, history)
+			}
+			continue
+		}
+		//quota is taken before publish so a batch never exceeds it, and refunded if not published
+		if reason := p.quota.take(history, p.now); reason != "" {
+			logger.Infow(fmt.Sprintf("skip history %s of owner %s", history.Id.Hex(), history.Owner.Hex()), "history", history, "reason", reason)
+			p.summary.skipped(history, reason)
+			continue
+		}
+		next := p.schedule.next(history, p.now)
+		history.Priority = next.Priority
+		p.batch = append(p.batch, history)
+		p.next = append(p.next, next)
+		if len(p.batch) >= p.batchSize {
+			if err := p.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("iterate history: %w", err)
+	}
+	if err := p.flush(ctx); err != nil {
+		return err
+	}
+	return p.resume.reset(ctx)
+}
+
+//publish the batch, save schedule of published history and the resume id
+func (p *publisher) flush(ctx context.Context) error {
+	if len(p.batch) == 0 {
+		return nil
+	}
+	if p.dryRun != nil {
+		p.flushDryRun()
+		return nil
+	}
+	ids := make([]string, len(p.batch))
+	requests := make([]rsmessage.RefreshRequest, len(p.batch))
+	for i, history := range p.batch {
+		ids[i] = history.Id.Hex()
+		requests[i] = rsmessage.RefreshRequest{HistoryID: history.Id.Hex(), Priority: history.Priority}
+	}
+	results, err := rstream.PublishOnceBatch(ctx, p.stream, p.pending, ids, requests)
+	if err != nil {
+		return err
+	}
+	var published []History
+	var schedules []schedule
+	for i, result := range results {
+		history := p.batch[i]
+		switch {
+		case result.Err != nil:
+			logger.Errorw("add history to stream error", "history", history, "error", result.Err)
+			p.summary.failed(history)
+			p.quota.refund(history)
+		case result.ID == "": //claimed after checked in run
+			logger.Infow(fmt.Sprintf("skip history %s with pending refresh", history.Id.Hex()), "history", history)
+			p.summary.skipped(history, SkipPending)
+			p.quota.refund(history)
+		default:
+			logger.Infow(fmt.Sprintf("add history %s to stream", history.Id.Hex()), "history", history, "message_id", result.ID)
+			p.summary.published(history)
+			published = append(published, history)
+			schedules = append(schedules, p.next[i])
+		}
+	}
+	if !p.keepSchedule {
+		if err := saveSchedules(ctx, p.col, published, schedules); err != nil {
+			return fmt.Errorf("save schedule: %w", err)
+		}
+	}
+	if err := p.resume.save(ctx, p.batch[len(p.batch)-1].Id); err != nil {
+		return fmt.Errorf("save resume id: %w", err)
+	}
+	p.batch, p.next = p.batch[:0], p.next[:0]
+	return nil
+}
+
+//print history of the batch, pending history is printed when checked in run
+func (p *publisher) flushDryRun() {
+	for _, history := range p.batch {
+		p.summary.published(history)
+		p.printDryRun("publish", history)
+	}
+	p.batch, p.next = p.batch[:0], p.next[:0]
+}
+
+//print history as "<publish|pending>\t<id>\t<type>\t<priority>\t<url>",
+//history with a pending refresh would be skipped by a real run
+func (p *publisher) printDryRun(action string, history History) {
+	fmt.Fprintf(p.dryRun, "%s\t%s\t%s\t%d\t%s\n", action, history.Id.Hex(), history.Type, history.Priority, history.Url)
+}
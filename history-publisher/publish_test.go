@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+)
+
+func TestResumeIds(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	ids := resumeIds{rdb: testRedis(t), key: "test.history-publisher.resume_id"}
+	t.Cleanup(func() { ids.reset(ctx) })
+
+	id, err := ids.load(ctx)
+	ast.Nil(err)
+	ast.True(id.IsZero())
+	saved := primitive.NewObjectID()
+	ast.Nil(ids.save(ctx, saved))
+	id, err = ids.load(ctx)
+	ast.Nil(err)
+	ast.Equal(saved, id)
+	ast.Nil(ids.reset(ctx))
+	id, err = ids.load(ctx)
+	ast.Nil(err)
+	ast.True(id.IsZero())
+}
+
+func testMongo(t *testing.T) *mongo.Database {
+	uri := os.Getenv("MONGO_TEST")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err == nil {
+		err = client.Ping(ctx, nil)
+	}
+	if err != nil {
+		t.Skip("mongodb not available", err)
+	}
+	database := client.Database("site_test")
+	t.Cleanup(func() {
+		database.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return database
+}
+
+func TestPublisher(t *testing.T) {
+	initLog()
+	ast := assert.New(t)
+	ctx := context.Background()
+	database := testMongo(t)
+	rdb := testRedis(t)
+	stream := rstream.RedisStream{}
+	stream.New(&rstream.StreamConfig{Client: rdb, Stream: "test.history.refresh"})
+	t.Cleanup(func() { rdb.Del(context.Background(), "test.history.refresh") })
+	pending := rstream.NewDedup(rdb, "test.history.pending", time.Minute)
+
+	now := time.Now()
+	owner := primitive.NewObjectID()
+	_, err := database.Collection(userCol).InsertOne(ctx, User{Id: owner, Quota: 2})
+	ast.Nil(err)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		history := History{Id: primitive.NewObjectID(), Url: "https://bbs.nga.cn/read.php?tid=1", Owner: owner}
+		switch i {
+		case 3:
+			history.Owner = primitive.NewObjectID() //no account
+		case 4:
+			history.NextRefreshAt = now.Add(time.Hour) //not due
+		}
+		_, err := database.Collection("history").InsertOne(ctx, history)
+		ast.Nil(err)
+		ids = append(ids, history.Id.Hex())
+	}
+	t.Cleanup(func() { pending.Release(context.Background(), ids...) })
+
+	ast.Nil(checkURLRegex(ctx, database.Collection("history"), `tid=\d+`))
+	ast.NotNil(checkURLRegex(ctx, database.Collection("history"), "("))
+
+	p := publisher{
+		col:       database.Collection("history"),
+		stream:    &stream,
+		pending:   pending,
+		schedule:  ScheduleConfig{MinInterval: time.Minute, MaxInterval: time.Hour, InitialInterval: time.Minute},
+		quota:     newOwnerQuota(OwnerConfig{}),
+		resume:    resumeIds{rdb: rdb, key: "test.history-publisher.resume_id"},
+		batchSize: 3, //pending history and the quota of owner in one batch
+		now:       now,
+	}
+	t.Cleanup(func() { p.resume.reset(context.Background()) })
+	_, err = pending.Claim(ctx, ids[0]) //pending history does not use quota of the next ones
+	ast.Nil(err)
+	ast.Nil(p.run(ctx, dueFilter(now)))
+	ast.Equal(ownerSummary{Published: 2, Skipped: map[string]int{SkipPending: 1, SkipNoAccount: 1}}, p.summary.total())
+	ast.Equal(int64(2), rdb.XLen(ctx, "test.history.refresh").Val())
+	id, err := p.resume.load(ctx)
+	ast.Nil(err)
+	ast.True(id.IsZero())
+
+	//published history is scheduled, the pending one is still due
+	cur, err := historyCursor(ctx, p.col, dueFilter(now), primitive.NilObjectID, 10)
+	ast.Nil(err)
+	var due []History
+	ast.Nil(cur.All(ctx, &due))
+	ast.Len(due, 2)
+
+	//resume after the second history
+	second, _ := primitive.ObjectIDFromHex(ids[1])
+	ast.Nil(p.resume.save(ctx, second))
+	p.summary = nil
+	p.quota = newOwnerQuota(OwnerConfig{})
+	ast.Nil(p.run(ctx, dueFilter(now)))
+	ast.Equal(ownerSummary{Skipped: map[string]int{SkipNoAccount: 1}}, p.summary.total())
+
+	//dry run prints selected history even if not due, nothing is published
+	out := &strings.Builder{}
+	p.summary = nil
+	p.dryRun = out
+	p.resume = resumeIds{}
+	first, _ := primitive.ObjectIDFromHex(ids[0])
+	fourth, _ := primitive.ObjectIDFromHex(ids[4])
+	ast.Nil(p.run(ctx, historyFilter(now, selector{ids: []primitive.ObjectID{first, fourth}})))
+	ast.Equal(ownerSummary{Published: 1, Skipped: map[string]int{SkipPending: 1}}, p.summary.total())
+	ast.Contains(out.String(), "pending\t"+ids[0])
+	ast.Contains(out.String(), "publish\t"+ids[4])
+	ast.Equal(int64(2), rdb.XLen(ctx, "test.history.refresh").Val())
+}
+
+func TestPublisherKeepSchedule(t *testing.T) {
+	initLog()
+	ast := assert.New(t)
+	ctx := context.Background()
+	database := testMongo(t)
+	rdb := testRedis(t)
+	stream := rstream.RedisStream{}
+	stream.New(&rstream.StreamConfig{Client: rdb, Stream: "test.history.other"})
+	t.Cleanup(func() { rdb.Del(context.Background(), "test.history.other") })
+	pending := rstream.NewDedup(rdb, "test.history.other.pending", time.Minute)
+
+	now := time.Now()
+	history := History{
+		Id:                 primitive.NewObjectID(),
+		Url:                "https://bbs.nga.cn/read.php?tid=1",
+		TotalPage:          3,
+		NextRefreshAt:      now.Add(-time.Minute).Truncate(time.Millisecond),
+		RefreshInterval:    time.Hour,
+		Priority:           1,
+		ScheduledTotalPage: 2,
+	}
+	_, err := database.Collection("history").InsertOne(ctx, history)
+	ast.Nil(err)
+	t.Cleanup(func() { pending.Release(context.Background(), history.Id.Hex()) })
+
+	p := publisher{
+		col:          database.Collection("history"),
+		stream:       &stream,
+		pending:      pending,
+		schedule:     ScheduleConfig{MinInterval: time.Minute, MaxInterval: time.Hour, InitialInterval: time.Minute},
+		quota:        newOwnerQuota(OwnerConfig{}),
+		batchSize:    2,
+		now:          now,
+		keepSchedule: true,
+	}
+	ast.Nil(p.run(ctx, dueFilter(now)))
+	ast.Equal(ownerSummary{Published: 1}, p.summary.total())
+	ast.Equal(int64(1), rdb.XLen(ctx, "test.history.other").Val())
+
+	//published to the test stream, the history is still due with its schedule
+	saved := History{}
+	ast.Nil(database.Collection("history").FindOne(ctx, bson.M{"_id": history.Id}).Decode(&saved))
+	ast.True(history.NextRefreshAt.Equal(saved.NextRefreshAt))
+	ast.Equal(history.RefreshInterval, saved.RefreshInterval)
+	ast.Equal(history.Priority, saved.Priority)
+	ast.Equal(history.ScheduledTotalPage, saved.ScheduledTotalPage)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ScheduleConfig struct {
+	MinInterval     time.Duration `mapstructure:"min_interval"`
+	MaxInterval     time.Duration `mapstructure:"max_interval"`
+	InitialInterval time.Duration `mapstructure:"initial_interval"` //interval of history never scheduled
+}
+
+//refresh schedule of a history, saved on the history document
+type schedule struct {
+	NextRefreshAt time.Time
+	Interval      time.Duration
+	Priority      int
+	TotalPage     int //total page when scheduled, compared with total page of next run
+}
+
+//interval is halved if the thread gained pages since last scheduled and doubled otherwise,
+//within [MinInterval, MaxInterval]
+func (config ScheduleConfig) next(history History, now time.Time) schedule {
+	interval := history.RefreshInterval
+	switch {
+	case interval == 0:
+		interval = config.InitialInterval
+	case history.TotalPage > history.ScheduledTotalPage:
+		interval /= 2
+	default:
+		interval *= 2
+	}
+	if interval < config.MinInterval {
+		interval = config.MinInterval
+	}
+	if interval > config.MaxInterval {
+		interval = config.MaxInterval
+	}
+	return schedule{
+		NextRefreshAt: now.Add(interval),
+		Interval:      interval,
+		Priority:      config.priority(interval),
+		TotalPage:     history.TotalPage,
+	}
+}
+
+//times the interval is halved from MaxInterval, 0 for the least active thread
+func (config ScheduleConfig) priority(interval time.Duration) int {
+	if interval <= 0 || interval >= config.MaxInterval {
+		return 0
+	}
+	return int(math.Log2(float64(config.MaxInterval) / float64(interval)))
+}
+
+//history not deleted and due to refresh
+func dueFilter(now time.Time) bson.M {
+	return bson.M{
+		"delete":          bson.M{"$ne": true},
+		"next_refresh_at": bson.M{"$not": bson.M{"$gt": now}}, //missing next_refresh_at is due
+	}
+}
+
+//history matching filter with its owner account, in order of _id so an interrupted run can resume after the last id
+func historyCursor(ctx context.Context, col *mongo.Collection, filter bson.M, after primitive.ObjectID, batchSize int32) (*mongo.Cursor, error) {
+	if !after.IsZero() {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": after}}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		lookupOwner(),
+		unwindOwner(),
+	}
+	return col.Aggregate(ctx, pipeline, options.Aggregate().SetBatchSize(batchSize))
+}
+
+//update schedule of published history in one bulk write
+func saveSchedules(ctx context.Context, col *mongo.Collection, historys []History, schedules []schedule) error {
+	if len(historys) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(historys))
+	for i, history := range historys {
+		models[i] = mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": history.Id}).SetUpdate(scheduleUpdate(schedules[i]))
+	}
+	_, err := col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func saveSchedule(ctx context.Context, col *mongo.Collection, history History, s schedule) error {
+	_, err := col.UpdateOne(ctx, bson.M{"_id": history.Id}, scheduleUpdate(s))
+	return err
+}
+
+func scheduleUpdate(s schedule) bson.M {
+	return bson.M{"$set": bson.M{
+		"next_refresh_at":      s.NextRefreshAt,
+		"refresh_interval":     s.Interval,
+		"priority":             s.Priority,
+		"scheduled_total_page": s.TotalPage,
+	}}
+}
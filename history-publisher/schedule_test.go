@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleNext(t *testing.T) {
+	config := ScheduleConfig{MinInterval: 15 * time.Minute, MaxInterval: 16 * time.Hour, InitialInterval: time.Hour}
+	now := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		history  History
+		interval time.Duration
+		priority int
+	}{
+		{"new", History{TotalPage: 3}, time.Hour, 4},
+		{"gained pages", History{TotalPage: 4, ScheduledTotalPage: 3, RefreshInterval: time.Hour}, 30 * time.Minute, 5},
+		{"inactive", History{TotalPage: 3, ScheduledTotalPage: 3, RefreshInterval: time.Hour}, 2 * time.Hour, 3},
+		{"hottest", History{TotalPage: 9, ScheduledTotalPage: 3, RefreshInterval: 20 * time.Minute}, 15 * time.Minute, 6},
+		{"dead", History{TotalPage: 3, ScheduledTotalPage: 3, RefreshInterval: 12 * time.Hour}, 16 * time.Hour, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast := assert.New(t)
+			next := config.next(test.history, now)
+			ast.Equal(test.interval, next.Interval)
+			ast.Equal(now.Add(test.interval), next.NextRefreshAt)
+			ast.Equal(test.priority, next.Priority)
+			ast.Equal(test.history.TotalPage, next.TotalPage)
+		})
+	}
+}
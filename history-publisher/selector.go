@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const usage = `usage: history-publisher [flags]
+
+publish refresh request of due history, or of history matching selectors even if not due.
+selectors are combined with and, -id and -type take comma separated lists or can be repeated.
+
+`
+
+//history selected by command line instead of schedule
+type selector struct {
+	ids           []primitive.ObjectID
+	types         []string
+	url           string    //regex of url, run by mongodb so it's PCRE instead of go regexp
+	crawledBefore time.Time //last crawled before or never crawled
+}
+
+func (s selector) empty() bool {
+	return len(s.ids) == 0 && len(s.types) == 0 && s.url == "" && s.crawledBefore.IsZero()
+}
+
+//filter of history to publish, history matching a non-empty selector is published even if not due
+func historyFilter(now time.Time, s selector) bson.M {
+	if s.empty() {
+		return dueFilter(now)
+	}
+	filter := bson.M{"delete": bson.M{"$ne": true}}
+	if len(s.ids) != 0 {
+		filter["_id"] = bson.M{"$in": s.ids}
+	}
+	if len(s.types) != 0 {
+		filter["type"] = bson.M{"$in": s.types}
+	}
+	if s.url != "" {
+		filter["url"] = bson.M{"$regex": s.url}
+	}
+	if !s.crawledBefore.IsZero() {
+		filter["last_crawled_at"] = bson.M{"$not": bson.M{"$gte": s.crawledBefore}}
+	}
+	return filter
+}
+
+type cmdFlags struct {
+	selector
+	dryRun bool
+	stream string //empty to use the refresh stream
+}
+
+//comma separated or repeated flag
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func parseFlags(args []string, now time.Time, output io.Writer) (cmdFlags, error) {
+	f := cmdFlags{}
+	var ids, types listFlag
+	var crawledBefore string
+	set := flag.NewFlagSet("history-publisher", flag.ContinueOnError)
+	set.SetOutput(output)
+	set.Var(&ids, "id", "history id in hex")
+	set.Var(&types, "type", "history type, e.g. nga,tieba")
+	set.StringVar(&f.url, "url", "", "regex of history url, in PCRE syntax of mongodb $regex")
+	set.StringVar(&crawledBefore, "crawled-before", "", "last crawled before time in RFC3339 or duration ago like 72h, never crawled history is included")
+	set.BoolVar(&f.dryRun, "dry-run", false, "print history that would be published without publishing or scheduling")
+	set.StringVar(&f.stream, "stream", "", "publish to this stream instead of the refresh stream, run once without saving schedule")
+	set.Usage = func() {
+		fmt.Fprint(set.Output(), usage)
+		set.PrintDefaults()
+	}
+	if err := set.Parse(args); err != nil {
+		return f, err
+	}
+	if set.NArg() != 0 {
+		return f, fmt.Errorf("unexpected arguments %v", set.Args())
+	}
+	f.types = types
+	for _, hex := range ids {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return f, fmt.Errorf("invalid id %q: %w", hex, err)
+		}
+		f.ids = append(f.ids, id)
+	}
+	if crawledBefore != "" {
+		if ago, err := time.ParseDuration(crawledBefore); err == nil {
+			f.crawledBefore = now.Add(-ago)
+		} else if f.crawledBefore, err = time.Parse(time.RFC3339, crawledBefore); err != nil {
+			return f, fmt.Errorf("invalid crawled-before %q, need RFC3339 time or duration", crawledBefore)
+		}
+	}
+	return f, nil
+}
+
+//url regex is checked by mongodb, which runs it with PCRE
+func checkURLRegex(ctx context.Context, col *mongo.Collection, pattern string) error {
+	err := col.FindOne(ctx, bson.M{"url": bson.M{"$regex": pattern}}, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseFlags(t *testing.T) {
+	ast := assert.New(t)
+	now := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	id := primitive.NewObjectID()
+
+	f, err := parseFlags(nil, now, io.Discard)
+	ast.Nil(err)
+	ast.True(f.selector.empty())
+	ast.False(f.dryRun)
+
+	f, err = parseFlags([]string{"-id", id.Hex(), "--type", "nga,tieba", "-type", "v2ex", "-url", `tid=\d+`, "-crawled-before", "72h", "--dry-run", "-stream", "test.refresh"}, now, io.Discard)
+	ast.Nil(err)
+	ast.Equal([]primitive.ObjectID{id}, f.ids)
+	ast.Equal([]string{"nga", "tieba", "v2ex"}, f.types)
+	ast.Equal(`tid=\d+`, f.url)
+	ast.Equal(now.Add(-72*time.Hour), f.crawledBefore)
+	ast.True(f.dryRun)
+	ast.Equal("test.refresh", f.stream)
+
+	f, err = parseFlags([]string{"-crawled-before", "2022-02-01T00:00:00Z"}, now, io.Discard)
+	ast.Nil(err)
+	ast.Equal(time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC), f.crawledBefore)
+
+	for _, args := range [][]string{{"-id", "620b8a"}, {"-crawled-before", "yesterday"}, {"extra"}, {"-unknown"}} {
+		_, err = parseFlags(args, now, io.Discard)
+		ast.NotNil(err, args)
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	ast := assert.New(t)
+	now := time.Now()
+	ast.Equal(dueFilter(now), historyFilter(now, selector{}))
+
+	id := primitive.NewObjectID()
+	filter := historyFilter(now, selector{ids: []primitive.ObjectID{id}, types: []string{"nga"}, url: "tid=1", crawledBefore: now})
+	ast.Equal(bson.M{
+		"delete":          bson.M{"$ne": true},
+		"_id":             bson.M{"$in": []primitive.ObjectID{id}},
+		"type":            bson.M{"$in": []string{"nga"}},
+		"url":             bson.M{"$regex": "tid=1"},
+		"last_crawled_at": bson.M{"$not": bson.M{"$gte": now}},
+	}, filter)
+	ast.NotContains(filter, "next_refresh_at")
+}
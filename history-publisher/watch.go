@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+)
+
+//resume token of the history change stream
+const defaultResumeTokenKey = "history-publisher.resume_token"
+
+//resume token is expired from oplog
+const changeStreamHistoryLost = 286
+
+//document of change stream, full document is looked up for update
+type changeEvent struct {
+	OperationType string   `bson:"operationType"`
+	FullDocument  *History `bson:"fullDocument"`
+}
+
+//resume token kept in redis
+type resumeTokens struct {
+	rdb *redis.Client
+	key string
+}
+
+//nil if not saved
+func (tokens resumeTokens) load(ctx context.Context) (bson.Raw, error) {
+	token, err := tokens.rdb.Get(ctx, tokens.key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return bson.Raw(token), err
+}
+
+func (tokens resumeTokens) save(ctx context.Context, token bson.Raw) error {
+	return tokens.rdb.Set(ctx, tokens.key, []byte(token), 0).Err()
+}
+
+func (tokens resumeTokens) reset(ctx context.Context) error {
+	return tokens.rdb.Del(ctx, tokens.key).Err()
+}
+
+//insert, replace and update of url
+func historyChangePipeline() mongo.Pipeline {
+	return mongo.Pipeline{{{Key: "$match", Value: bson.M{"$or": bson.A{
+		bson.M{"operationType": bson.M{"$in": bson.A{"insert", "replace"}}},
+		bson.M{"operationType": "update", "updateDescription.updatedFields.url": bson.M{"$exists": true}},
+	}}}}}
+}
+
+//history to refresh for the change, deleted history is skipped
+func refreshHistory(event changeEvent) (History, bool) {
+	if event.FullDocument == nil || event.FullDocument.Delete {
+		return History{}, false
+	}
+	return *event.FullDocument, true
+}
+
+type historyWatcher struct {
+	col      *mongo.Collection
+	stream   *rstream.RedisStream
+	pending  *rstream.Dedup
+	tokens   resumeTokens
+	schedule ScheduleConfig
+	users    *mongo.Collection
+}
+
+//publish refresh request on history change until ctx is done, the change stream is reopened on error
+func (w *historyWatcher) run(ctx context.Context) error {
+	retry := time.Second
+	for {
+		err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(changeStreamHistoryLost) {
+			logger.Warnw("resume token expired, watch from now", "error", err)
+			if err := w.tokens.reset(ctx); err != nil {
+				logger.Errorw("reset resume token error", "error", err)
+			}
+		}
+		logger.Errorw("watch history error, retry", "error", err, "retry", retry)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+		if retry < time.Minute {
+			retry *= 2
+		}
+	}
+}
+
+func (w *historyWatcher) watch(ctx context.Context) error {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	token, err := w.tokens.load(ctx)
+	if err != nil {
+		return fmt.Errorf("load resume token: %w", err)
+	}
+	if token != nil {
+		opts.SetStartAfter(token)
+	}
+	cs, err := w.col.Watch(ctx, historyChangePipeline(), opts)
+	if err != nil {
+		return err
+	}
+	defer cs.Close(context.Background())
+	logger.Infow("watch history", "resume", token != nil)
+	for cs.Next(ctx) {
+		event := changeEvent{}
+		if err := cs.Decode(&event); err != nil {
+			logger.Errorw("decode change event error", "event", cs.Current.String(), "error", err)
+		} else if history, ok := refreshHistory(event); ok {
+			w.publish(ctx, event.OperationType, history)
+		}
+		//token is saved after publish, a change may be published twice but never lost
+		if err := w.tokens.save(ctx, cs.ResumeToken()); err != nil {
+			logger.Errorw("save resume token error", "error", err)
+		}
+	}
+	return cs.Err()
+}
+
+//changed history is refreshed now and scheduled as a new one, schedule update is not watched
+func (w *historyWatcher) publish(ctx context.Context, operation string, history History) {
+	if !history.Owner.IsZero() {
+		user, err := findOwner(ctx, w.users, history.Owner)
+		if err != nil {
+			logger.Errorw("find owner error", "history", history, "error", err)
+			return
+		}
+		if status := accountStatus(user, time.Now()); status != "" {
+			logger.Infow(fmt.Sprintf("skip history %s of owner %s", history.Id.Hex(), history.Owner.Hex()), "history", history, "operation", operation, "reason", status)
+			return
+		}
+	}
+	history.RefreshInterval = 0
+	next := w.schedule.next(history, time.Now())
+	history.Priority = next.Priority
+	id, err := addIdToStream(ctx, w.stream, w.pending, history)
+	if err != nil {
+		logger.Errorw("add history to stream error", "history", history, "operation", operation, "error", err)
+		return
+	}
+	if id == "" {
+		logger.Infow(fmt.Sprintf("skip history %s with pending refresh", history.Id.Hex()), "history", history, "operation", operation)
+		return
+	}
+	logger.Infow(fmt.Sprintf("add history %s to stream", history.Id.Hex()), "history", history, "operation", operation, "message_id", id)
+	if err := saveSchedule(ctx, w.col, history, next); err != nil {
+		logger.Errorw("save schedule error", "history", history, "error", err)
+	}
+}
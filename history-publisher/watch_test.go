@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+)
+
+func TestRefreshHistory(t *testing.T) {
+	ast := assert.New(t)
+	id := primitive.NewObjectID()
+	history, ok := refreshHistory(changeEvent{OperationType: "insert", FullDocument: &History{Id: id, Url: "https://bbs.nga.cn/read.php?tid=1"}})
+	ast.True(ok)
+	ast.Equal(id, history.Id)
+	_, ok = refreshHistory(changeEvent{OperationType: "update", FullDocument: &History{Id: id, Delete: true}})
+	ast.False(ok)
+	_, ok = refreshHistory(changeEvent{OperationType: "update"}) //deleted before lookup
+	ast.False(ok)
+}
+
+func testRedis(t *testing.T) *redis.Client {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skip("redis not available", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func TestResumeTokens(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	tokens := resumeTokens{rdb: testRedis(t), key: "test.history-publisher.resume_token"}
+	t.Cleanup(func() { tokens.reset(ctx) })
+
+	token, err := tokens.load(ctx)
+	ast.Nil(err)
+	ast.Nil(token)
+	raw, _ := bson.Marshal(bson.M{"_data": "8262"})
+	ast.Nil(tokens.save(ctx, raw))
+	token, err = tokens.load(ctx)
+	ast.Nil(err)
+	ast.Equal(bson.Raw(raw), token)
+}
+
+//change stream needs a replica set, start one with `mongod --replSet rs0` and `rs.initiate()`
+func TestHistoryWatcher(t *testing.T) {
+	initLog()
+	ast := assert.New(t)
+	uri := os.Getenv("MONGO_REPLICA_SET")
+	if uri == "" {
+		uri = "mongodb://localhost:27017/?replicaSet=rs0&directConnection=true"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		t.Skip("mongodb not available", err)
+	}
+	defer client.Disconnect(context.Background())
+	col := client.Database("site_test").Collection("history")
+	if _, err := col.Watch(ctx, mongo.Pipeline{}); err != nil {
+		t.Skip("mongodb replica set not available", err)
+	}
+	t.Cleanup(func() { col.Drop(context.Background()) })
+
+	rdb := testRedis(t)
+	stream := rstream.RedisStream{}
+	stream.New(&rstream.StreamConfig{Client: rdb, Stream: "test.history.refresh"})
+	t.Cleanup(func() { rdb.Del(context.Background(), "test.history.refresh") })
+	pending := rstream.NewDedup(rdb, "test.history.pending", time.Minute)
+	watcher := historyWatcher{
+		col:     col,
+		stream:  &stream,
+		pending: pending,
+		tokens:  resumeTokens{rdb: rdb, key: "test.history-publisher.resume_token"},
+	}
+	t.Cleanup(func() { watcher.tokens.reset(context.Background()) })
+	ctxWatch, stop := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- watcher.run(ctxWatch) }()
+	time.Sleep(500 * time.Millisecond) //wait change stream open
+
+	id := primitive.NewObjectID()
+	t.Cleanup(func() { pending.Release(context.Background(), id.Hex()) })
+	_, err = col.InsertOne(ctx, History{Id: id, Url: "https://bbs.nga.cn/read.php?tid=1"})
+	ast.Nil(err)
+	_, err = col.UpdateByID(ctx, id, bson.M{"$set": bson.M{"title": "no refresh"}})
+	ast.Nil(err)
+	ast.Eventually(func() bool { return rdb.XLen(ctx, "test.history.refresh").Val() == 1 }, 5*time.Second, 100*time.Millisecond)
+
+	pending.Release(ctx, id.Hex())
+	_, err = col.UpdateByID(ctx, id, bson.M{"$set": bson.M{"url": "https://bbs.nga.cn/read.php?tid=2"}})
+	ast.Nil(err)
+	ast.Eventually(func() bool { return rdb.XLen(ctx, "test.history.refresh").Val() == 2 }, 5*time.Second, 100*time.Millisecond)
+
+	stop()
+	ast.ErrorIs(<-done, context.Canceled)
+	token, err := watcher.tokens.load(ctx)
+	ast.Nil(err)
+	ast.NotNil(token)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+)
+
+func logLine(ts string) string {
+	return `{"level":"info","ts":"` + ts + `","msg":"crawl"}`
+}
+
+func logMessage(id, subject string, line interface{}) rstream.XMessage {
+	return rstream.XMessage{XMessage: redis.XMessage{ID: id, Values: map[string]interface{}{subject: line}}}
+}
+
+func TestBatchStreams(t *testing.T) {
+	msgs := []rstream.XMessage{
+		logMessage("1-0", "go-learn.history-crawl", logLine("2022-02-15T20:01:00.000+0800")),
+		logMessage("2-0", "go-learn.history-publisher", logLine("2022-02-15T20:02:00.000+0800")),
+		logMessage("3-0", "go-learn.history-crawl", logLine("2022-02-15T20:03:00.500+0800")),
+		logMessage("4-0", "go-learn.history-crawl", "not json"),
+		logMessage("5-0", "go-learn.history-crawl", logLine("yesterday")),
+		logMessage("6-0", "go-learn.history-crawl", 1),
+	}
+	result := batchStreams(msgs)
+	sort.Slice(result.Streams, func(i, j int) bool { return result.Streams[i].Stream.Subject < result.Streams[j].Stream.Subject })
+	expected := []StreamItem{
+		{Stream: Label{Subject: "go-learn.history-crawl"}, Values: [][2]string{
+			{"1644926460000000000", logLine("2022-02-15T20:01:00.000+0800")},
+			{"1644926580500000000", logLine("2022-02-15T20:03:00.500+0800")},
+		}},
+		{Stream: Label{Subject: "go-learn.history-publisher"}, Values: [][2]string{
+			{"1644926520000000000", logLine("2022-02-15T20:02:00.000+0800")},
+		}},
+	}
+	if !reflect.DeepEqual(expected, result.Streams) {
+		t.Errorf("batch streams\nexpected %v\ngot      %v", expected, result.Streams)
+	}
+	if result := batchStreams(msgs[3:]); len(result.Streams) != 0 {
+		t.Error("malformed lines are not dropped", result.Streams)
+	}
+}
+
+func TestPushTimeout(t *testing.T) {
+	hung := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hung:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(hung)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := Push(ctx, server.URL, &Streams{}); err == nil {
+		t.Error("push to hung loki should fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("push is not limited by context", elapsed)
+	}
+}
@@ -1,8 +1,9 @@
 module github.com/lyineee/go-learn/loki-redis
 
-go 1.17
+go 1.18
 
 require (
+	github.com/go-redis/redis/v8 v8.11.4
 	github.com/lyineee/go-learn/redis-stream v0.0.0-20220212161122-4e7cfa94169e
 	github.com/lyineee/go-learn/utils v0.1.1-0.20220215135452-e024f414a3f9
 	github.com/spf13/viper v1.10.1
@@ -13,7 +14,6 @@ require (
 	github.com/coreos/etcd v2.3.8+incompatible // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/fsnotify/fsnotify v1.5.1 // indirect
-	github.com/go-redis/redis/v8 v8.11.4 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/magiconair/properties v1.8.5 // indirect
@@ -24,6 +24,8 @@ require (
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/subosito/gotenv v1.2.0 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	go.etcd.io/etcd v2.3.8+incompatible // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
@@ -8,7 +8,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	rstream "github.com/lyineee/go-learn/redis-stream"
@@ -35,6 +37,9 @@ type Ts struct {
 
 var logger = log.NewLogger(log.NewJsonCore(os.Stdout), log.InfoLevel)
 
+//push is also limited by timeout of the batch context
+var lokiClient = &http.Client{Timeout: 5 * time.Second}
+
 func main() {
 	// get envirment
 	viper.AutomaticEnv()
@@ -49,9 +54,14 @@ func main() {
 	//stream
 	viper.SetDefault("stream.stream", "stream.log")
 	viper.SetDefault("stream.group", "stream.log.worker")
+	viper.SetDefault("stream.reclaim_idle", "5m")
+	viper.SetDefault("stream.batch_size", 100)
+	viper.SetDefault("stream.block", "1s") //max wait for a batch
+	viper.SetDefault("stream.timeout", "5s")
 
 	//loki
 	viper.SetDefault("loki.address", "http://localhost:3100")
+	viper.SetDefault("loki.timeout", "5s")
 
 	viper.AddRemoteProvider("etcd", viper.GetString("etcd"), viper.GetString("etcd_config_path"))
 	viper.SetConfigType("toml")
@@ -67,19 +77,42 @@ func main() {
 		logger.Fatal("err", log.Error(err))
 	}
 
-	for i := range group.Subscribe() {
-		if i.Error != nil {
-			logger.Error("err", log.Error(i.Error))
-			continue
+	lokiClient.Timeout = viper.GetDuration("loki.timeout")
+	ctxSignal, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	consumer := rstream.NewBatchConsumer(&group, viper.GetInt64("stream.batch_size"), func(ctx context.Context, msgs []rstream.XMessage) error {
+		result := batchStreams(msgs)
+		if len(result.Streams) == 0 {
+			return nil
+		}
+		loki := viper.GetString("loki.address") + "/loki/api/v1/push"
+		err := Push(ctx, loki, result)
+		if err != nil {
+			logger.Error("error when push to loki", log.String("loki_url", loki), log.Int("count", len(msgs)), log.Error(err))
+			return err
 		}
-		for key := range i.Values {
-			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-			item := StreamItem{}
+		return nil
+	})
+	consumer.Timeout = viper.GetDuration("stream.timeout")
+	err = consumer.Run(ctxSignal, rstream.WithPending(), rstream.WithReclaim(viper.GetDuration("stream.reclaim_idle")), rstream.WithBlock(viper.GetDuration("stream.block")))
+	logger.Info("graceful shutdown", log.Error(err))
+}
+
+//group log lines by subject into one push payload, malformed lines are dropped
+func batchStreams(msgs []rstream.XMessage) *Streams {
+	items := map[string]*StreamItem{}
+	result := Streams{}
+	for _, i := range msgs {
+		for key, value := range i.Values {
+			row, ok := value.(string)
+			if !ok {
+				logger.Error("log line is not string", log.String("subject", key), log.Any("value", value))
+				continue
+			}
 			ts := Ts{}
-			item.Stream.Subject = key //subject key
-			err := json.Unmarshal([]byte(i.Values[key].(string)), &ts)
+			err := json.Unmarshal([]byte(row), &ts)
 			if err != nil {
-				logger.Error("unmarshal json error", log.String("row_json", i.Values[key].(string)), log.Error(err))
+				logger.Error("unmarshal json error", log.String("row_json", row), log.Error(err))
 				continue
 			}
 			t, err := time.Parse("2006-01-02T15:04:05.999-0700", ts.Ts)
@@ -87,26 +120,18 @@ func main() {
 				logger.Error("parse time error", log.Error(err))
 				continue
 			}
-			line := [2]string{strconv.FormatInt(t.UnixNano(), 10), i.Values[key].(string)}
-			item.Values = make([][2]string, 1) //line init
-			item.Values[0] = line
-			result := Streams{[]StreamItem{item}}
-			js, err := json.Marshal(result)
-			if err != nil {
-				logger.Error("marshal payload error", log.Error(err))
-				continue
+			item, ok := items[key]
+			if !ok {
+				item = &StreamItem{Stream: Label{Subject: key}} //subject key
+				items[key] = item
 			}
-			logger.Info("result", log.Any("js", string(js)))
-			loki := viper.GetString("loki.address") + "/loki/api/v1/push"
-			err = Push(ctx, loki, &result)
-			if err != nil {
-				logger.Error("error when push to loki", log.String("loki_url", loki), log.Error(err))
-				continue
-			}
-			group.Ack(ctx, i.ID)
-			cancel()
+			item.Values = append(item.Values, [2]string{strconv.FormatInt(t.UnixNano(), 10), row})
 		}
 	}
+	for _, item := range items {
+		result.Streams = append(result.Streams, *item)
+	}
+	return &result
 }
 
 //push line to loki instance
@@ -115,7 +140,12 @@ func Push(ctx context.Context, url string, streams *Streams) error {
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(url, "application/json", bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := lokiClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,291 @@
+package rstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lyineee/go-learn/utils/log"
+)
+
+var ErrGroupNotFound = errors.New("consumer group not found")
+
+//consumer id generated by ConsumerGroup.New
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+//XINFO STREAM
+type StreamInfo struct {
+	Length          int64
+	Groups          int64
+	LastGeneratedID string
+	FirstEntryID    string //empty if stream is empty
+	LastEntryID     string
+}
+
+//XINFO GROUPS, EntriesRead and Lag are -1 if unknown (before redis 7)
+type GroupInfo struct {
+	Name            string
+	Consumers       int64
+	Pending         int64
+	LastDeliveredID string
+	EntriesRead     int64
+	Lag             int64
+}
+
+//XINFO CONSUMERS, Inactive is -1 if unknown (before redis 7.2)
+type ConsumerInfo struct {
+	Name     string
+	Pending  int64
+	Idle     time.Duration //since last attempted interaction
+	Inactive time.Duration //since last successful interaction
+}
+
+//consumer named by a uuid, i.e. created with an empty ConsumerID by a pod
+func (info ConsumerInfo) Generated() bool {
+	return uuidPattern.MatchString(info.Name)
+}
+
+//go-redis v8 fails to parse XINFO reply of redis 7, so the reply is parsed here
+func (stream *RedisStream) Info(ctx context.Context) (info StreamInfo, err error) {
+	reply, err := stream.client.Do(ctx, "XINFO", "STREAM", stream.stream).Result()
+	if err != nil {
+		return
+	}
+	fields, err := replyMap(reply)
+	if err != nil {
+		return
+	}
+	info.Length = replyInt(fields["length"], 0)
+	info.Groups = replyInt(fields["groups"], 0)
+	info.LastGeneratedID = replyString(fields["last-generated-id"])
+	info.FirstEntryID = replyEntryID(fields["first-entry"])
+	info.LastEntryID = replyEntryID(fields["last-entry"])
+	return
+}
+
+func (stream *RedisStream) Groups(ctx context.Context) (groups []GroupInfo, err error) {
+	reply, err := stream.client.Do(ctx, "XINFO", "GROUPS", stream.stream).Result()
+	if err != nil {
+		return
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected XINFO GROUPS reply %T", reply)
+	}
+	for _, item := range items {
+		fields, err := replyMap(item)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, GroupInfo{
+			Name:            replyString(fields["name"]),
+			Consumers:       replyInt(fields["consumers"], 0),
+			Pending:         replyInt(fields["pending"], 0),
+			LastDeliveredID: replyString(fields["last-delivered-id"]),
+			EntriesRead:     replyInt(fields["entries-read"], -1),
+			Lag:             replyInt(fields["lag"], -1),
+		})
+	}
+	return
+}
+
+//info of one group, ErrGroupNotFound if not exist
+func (stream *RedisStream) Group(ctx context.Context, name string) (info GroupInfo, err error) {
+	groups, err := stream.Groups(ctx)
+	if err != nil {
+		return
+	}
+	for _, group := range groups {
+		if group.Name == name {
+			return group, nil
+		}
+	}
+	return info, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+}
+
+func (stream *RedisStream) Consumers(ctx context.Context, group string) (consumers []ConsumerInfo, err error) {
+	reply, err := stream.client.Do(ctx, "XINFO", "CONSUMERS", stream.stream, group).Result()
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			err = fmt.Errorf("%w: %s", ErrGroupNotFound, group)
+		}
+		return
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected XINFO CONSUMERS reply %T", reply)
+	}
+	for _, item := range items {
+		fields, err := replyMap(item)
+		if err != nil {
+			return nil, err
+		}
+		inactive := time.Duration(-1)
+		if ms := replyInt(fields["inactive"], -1); ms >= 0 {
+			inactive = time.Duration(ms) * time.Millisecond
+		}
+		consumers = append(consumers, ConsumerInfo{
+			Name:     replyString(fields["name"]),
+			Pending:  replyInt(fields["pending"], 0),
+			Idle:     time.Duration(replyInt(fields["idle"], 0)) * time.Millisecond,
+			Inactive: inactive,
+		})
+	}
+	return
+}
+
+//generated consumers idle for at least minIdle, probably left by crashed pods
+func (stream *RedisStream) StaleConsumers(ctx context.Context, group string, minIdle time.Duration) (stale []ConsumerInfo, err error) {
+	consumers, err := stream.Consumers(ctx, group)
+	if err != nil {
+		return
+	}
+	for _, consumer := range consumers {
+		if consumer.Generated() && consumer.Idle >= minIdle {
+			stale = append(stale, consumer)
+		}
+	}
+	return
+}
+
+//remove consumer from group, its pending entries are dropped from the pending list.
+//return number of pending entries the consumer had
+func (stream *RedisStream) DeleteConsumer(ctx context.Context, group, consumer string) (int64, error) {
+	pending, err := stream.client.XGroupDelConsumer(ctx, stream.stream, group, consumer).Result()
+	if err != nil {
+		stream.logger.Error("delete consumer fail", log.String("group", group), log.String("consumer", consumer), log.Error(err))
+		return 0, err
+	}
+	stream.logger.Info("delete consumer", log.String("group", group), log.String("consumer", consumer), log.Any("pending", pending))
+	return pending, nil
+}
+
+//delete stale consumers, consumers with pending entries are kept unless force
+//so the entries can still be reclaimed by live consumers
+func (stream *RedisStream) DeleteStaleConsumers(ctx context.Context, group string, minIdle time.Duration, force bool) (deleted []string, err error) {
+	stale, err := stream.StaleConsumers(ctx, group, minIdle)
+	if err != nil {
+		return
+	}
+	for _, consumer := range stale {
+		if consumer.Pending > 0 && !force {
+			continue
+		}
+		if _, err = stream.DeleteConsumer(ctx, group, consumer.Name); err != nil {
+			return
+		}
+		deleted = append(deleted, consumer.Name)
+	}
+	return
+}
+
+//set last delivered id of group, "$" for the end of stream and "0" to redeliver everything
+func (stream *RedisStream) SetGroupID(ctx context.Context, group, id string) error {
+	err := stream.client.XGroupSetID(ctx, stream.stream, group, id).Err()
+	if err != nil {
+		stream.logger.Error("set group id fail", log.String("group", group), log.String("id", id), log.Error(err))
+		return err
+	}
+	stream.logger.Info("set group id", log.String("group", group), log.String("id", id))
+	return nil
+}
+
+//last count entries in stream order
+func (stream *RedisStream) Tail(ctx context.Context, count int64) ([]redis.XMessage, error) {
+	msgs, err := stream.client.XRevRangeN(ctx, stream.stream, "+", "-", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
+}
+
+//call handle for every entry added after id until ctx is done or handle return false,
+//id "$" follows new entries only
+func (stream *RedisStream) Follow(ctx context.Context, id string, handle func(redis.XMessage) bool) error {
+	if id == "$" { //XREAD with "$" again would miss entries added between reads
+		last, err := stream.Tail(ctx, 1)
+		if err != nil {
+			return err
+		}
+		id = "0"
+		if len(last) != 0 {
+			id = last[0].ID
+		}
+	}
+	retry := backoff{}
+	for ctx.Err() == nil {
+		streams, err := stream.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{stream.stream, id},
+			Block:   defaultBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil || !retry.wait(ctx) {
+				break
+			}
+			continue
+		}
+		retry.reset()
+		for _, msg := range streams[0].Messages {
+			id = msg.ID
+			if !handle(msg) {
+				return nil
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+//flat key value array (resp2) or map (resp3) to map
+func replyMap(reply interface{}) (map[string]interface{}, error) {
+	switch v := reply.(type) {
+	case map[interface{}]interface{}:
+		fields := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			fields[fmt.Sprint(key)] = value
+		}
+		return fields, nil
+	case []interface{}:
+		if len(v)%2 != 0 {
+			return nil, fmt.Errorf("unexpected XINFO reply length %d", len(v))
+		}
+		fields := make(map[string]interface{}, len(v)/2)
+		for i := 0; i < len(v); i += 2 {
+			fields[fmt.Sprint(v[i])] = v[i+1]
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("unexpected XINFO reply %T", reply)
+}
+
+func replyString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+//def is returned for nil or missing value
+func replyInt(v interface{}, def int64) int64 {
+	n, ok := v.(int64)
+	if !ok {
+		return def
+	}
+	return n
+}
+
+//id of [id, [field, value...]]
+func replyEntryID(v interface{}) string {
+	entry, ok := v.([]interface{})
+	if !ok || len(entry) == 0 {
+		return ""
+	}
+	return replyString(entry[0])
+}
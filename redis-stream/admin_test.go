@@ -0,0 +1,96 @@
+package rstream_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupsConsumers(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.admin")
+	stale := uuid.NewString()
+	group := testGroup(t, rdb, "stream.test.admin", stale)
+	stream := testStream(t, rdb, "stream.test.admin")
+	for i := 0; i < 3; i++ {
+		stream.Add(ctx, map[string]interface{}{"id": i})
+	}
+	_, err := group.ReadBatch(ctx, 2, 100*time.Millisecond)
+	ast.Nil(err)
+	live := testGroup(t, rdb, "stream.test.admin", "consumer-1")
+	_, err = live.ReadBatch(ctx, 1, 100*time.Millisecond)
+	ast.Nil(err)
+
+	info, err := stream.Info(ctx)
+	ast.Nil(err)
+	ast.Equal(int64(3), info.Length)
+	groups, err := stream.Groups(ctx)
+	ast.Nil(err)
+	ast.Len(groups, 1)
+	ast.Equal("test.workers", groups[0].Name)
+	ast.Equal(int64(2), groups[0].Consumers)
+	ast.Equal(int64(3), groups[0].Pending)
+	_, err = stream.Group(ctx, "none")
+	ast.True(errors.Is(err, rstream.ErrGroupNotFound))
+
+	consumers, err := stream.Consumers(ctx, "test.workers")
+	ast.Nil(err)
+	pending := map[string]int64{}
+	for _, consumer := range consumers {
+		pending[consumer.Name] = consumer.Pending
+	}
+	ast.Equal(map[string]int64{stale: 2, "consumer-1": 1}, pending)
+
+	staleConsumers, err := stream.StaleConsumers(ctx, "test.workers", 0)
+	ast.Nil(err)
+	ast.Len(staleConsumers, 1)
+	ast.Equal(stale, staleConsumers[0].Name)
+	deleted, err := stream.DeleteStaleConsumers(ctx, "test.workers", 0, false)
+	ast.Nil(err)
+	ast.Len(deleted, 0) //has pending entries
+	deleted, err = stream.DeleteStaleConsumers(ctx, "test.workers", 0, true)
+	ast.Nil(err)
+	ast.Equal([]string{stale}, deleted)
+	consumers, err = stream.Consumers(ctx, "test.workers")
+	ast.Nil(err)
+	ast.Len(consumers, 1)
+}
+
+func TestTailFollow(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.tail")
+	stream := testStream(t, rdb, "stream.test.tail")
+	for i := 0; i < 5; i++ {
+		stream.Add(ctx, map[string]interface{}{"id": i})
+	}
+	msgs, err := stream.Tail(ctx, 2)
+	ast.Nil(err)
+	ast.Len(msgs, 2)
+	ast.Equal("3", msgs[0].Values["id"])
+	ast.Equal("4", msgs[1].Values["id"])
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		stream.Add(ctx, map[string]interface{}{"id": 5})
+	}()
+	ctxFollow, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	got := []redis.XMessage{}
+	err = stream.Follow(ctxFollow, "$", func(msg redis.XMessage) bool {
+		got = append(got, msg)
+		return false
+	})
+	ast.Nil(err)
+	ast.Len(got, 1)
+	ast.Equal("5", got[0].Values["id"])
+}
@@ -0,0 +1,111 @@
+package rstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lyineee/go-learn/utils/log"
+)
+
+//read up to count new entries, wait at most block when the stream is empty
+func (group *ConsumerGroup) ReadBatch(ctx context.Context, count int64, block time.Duration) ([]redis.XMessage, error) {
+	return group.read(ctx, ">", count, block)
+}
+
+//ack all ids in one pipelined round trip
+func (group *ConsumerGroup) AckMany(ctx context.Context, ids ...string) (err error) {
+	if len(ids) == 0 {
+		return nil
+	}
+	var ack *redis.IntCmd
+	_, err = group.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		ack = pipe.XAck(ctx, group.stream, group.group, ids...)
+		if group.MaxDelivery > 0 {
+			pipe.HDel(ctx, group.errorKey(), ids...)
+		}
+		return nil
+	})
+	if err != nil {
+		group.logger.Error("fail to ack redis queue", log.Int("count", len(ids)), log.Error(err))
+		return
+	}
+	if acked := ack.Val(); acked != int64(len(ids)) {
+		group.logger.Info("ack already done", log.Int("count", len(ids)), log.Any("acked", acked))
+	}
+	return
+}
+
+type BatchHandler func(ctx context.Context, msgs []XMessage) error
+
+//hand messages to handler in batch, ack the whole batch with AckMany if handler return nil
+type BatchConsumer struct {
+	group   *ConsumerGroup
+	size    int64
+	handler BatchHandler
+	Timeout time.Duration //timeout of one batch
+}
+
+func NewBatchConsumer(group *ConsumerGroup, size int64, handler BatchHandler) *BatchConsumer {
+	if size < 1 {
+		size = 1
+	}
+	return &BatchConsumer{
+		group:   group,
+		size:    size,
+		handler: handler,
+		Timeout: defaultHandleTimeout,
+	}
+}
+
+//consume until ctx is done, WithBlock sets how long to wait for a batch
+func (consumer *BatchConsumer) Run(ctx context.Context, opts ...SubscribeOption) error {
+	consumer.group.consume(ctx, consumer.size, opts, func(msgs []redis.XMessage, err error) bool {
+		if err != nil {
+			return true
+		}
+		for len(msgs) != 0 { //pending and reclaimed entries may exceed the batch size
+			n := len(msgs)
+			if int64(n) > consumer.size {
+				n = int(consumer.size)
+			}
+			consumer.process(msgs[:n])
+			msgs = msgs[n:]
+		}
+		return true
+	})
+	consumer.group.logger.Info("batch consumer stopped", log.String("consumer", consumer.group.ConsumerID))
+	return ctx.Err()
+}
+
+func (consumer *BatchConsumer) process(msgs []redis.XMessage) {
+	batch := make([]XMessage, len(msgs))
+	ids := make([]string, len(msgs))
+	for i, msg := range msgs {
+		batch[i] = XMessage{XMessage: msg}
+		ids[i] = msg.ID
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), consumer.Timeout)
+	err := consumer.handle(ctx, batch)
+	cancel()
+	ctxAck, cancelAck := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelAck()
+	if err != nil {
+		consumer.group.logger.Error("handle batch fail", log.Int("count", len(ids)), log.Error(err))
+		for _, id := range ids {
+			consumer.group.Nack(ctxAck, id, err)
+		}
+		return
+	}
+	consumer.group.AckMany(ctxAck, ids...)
+}
+
+func (consumer *BatchConsumer) handle(ctx context.Context, msgs []XMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return consumer.handler(ctx, msgs)
+}
@@ -0,0 +1,67 @@
+package rstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBatchAckMany(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.batch")
+	group := testGroup(t, rdb, "stream.test.batch", "consumer-1")
+	stream := testStream(t, rdb, "stream.test.batch")
+	for i := 0; i < 5; i++ {
+		stream.Add(ctx, map[string]interface{}{"id": i})
+	}
+
+	msgs, err := group.ReadBatch(ctx, 3, 100*time.Millisecond)
+	ast.Nil(err)
+	ast.Len(msgs, 3)
+	ids := []string{}
+	for _, msg := range msgs {
+		ids = append(ids, msg.ID)
+	}
+	ast.Nil(group.AckMany(ctx, ids...))
+	pending, err := group.Pending(ctx, "", 10)
+	ast.Nil(err)
+	ast.Len(pending, 0)
+
+	msgs, err = group.ReadBatch(ctx, 3, 100*time.Millisecond)
+	ast.Nil(err)
+	ast.Len(msgs, 2)
+	msgs, err = group.ReadBatch(ctx, 3, 100*time.Millisecond)
+	ast.Nil(err)
+	ast.Len(msgs, 0)
+}
+
+func TestBatchConsumer(t *testing.T) {
+	ast := assert.New(t)
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.batch-consumer")
+	group := testGroup(t, rdb, "stream.test.batch-consumer", "consumer-1")
+	stream := testStream(t, rdb, "stream.test.batch-consumer")
+	for i := 0; i < 5; i++ {
+		stream.Add(context.Background(), map[string]interface{}{"id": i})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sizes := []int{}
+	consumer := rstream.NewBatchConsumer(&group, 3, func(ctx context.Context, msgs []rstream.XMessage) error {
+		if sizes = append(sizes, len(msgs)); len(sizes) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	err := consumer.Run(ctx, rstream.WithBlock(100*time.Millisecond))
+	ast.Equal(context.Canceled, err)
+	ast.Equal([]int{3, 2}, sizes)
+	pending, err := group.Pending(context.Background(), "", 10)
+	ast.Nil(err)
+	ast.Len(pending, 0)
+}
@@ -0,0 +1,275 @@
+//admin command of redis stream consumer groups
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	rstream "github.com/lyineee/go-learn/redis-stream"
+)
+
+const usage = `usage: rstream [-redis addr] [-password pass] <command> [flags]
+
+commands:
+  info       show stream length and first/last entry
+  groups     list consumer groups with pending and lag
+  consumers  show pending and idle time of every consumer in a group
+  prune      delete stale consumers named by uuid
+  setid      reset last delivered id of a group
+  tail       print last entries of a stream, -f to follow
+`
+
+var (
+	address  string
+	password string
+)
+
+func main() {
+	flag.StringVar(&address, "redis", env("REDIS", "localhost:6379"), "redis address, env REDIS")
+	flag.StringVar(&password, "password", os.Getenv("REDIS_PASSWORD"), "redis password, env REDIS_PASSWORD")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "info":
+		err = info(ctx, args)
+	case "groups":
+		err = groups(ctx, args)
+	case "consumers":
+		err = consumers(ctx, args)
+	case "prune":
+		err = prune(ctx, args)
+	case "setid":
+		err = setID(ctx, args)
+	case "tail":
+		err = tail(ctx, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func env(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+//flag set with the -stream flag, and -group if group is not nil
+func newFlagSet(name string, stream, group *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(stream, "stream", "", "stream name")
+	if group != nil {
+		fs.StringVar(group, "group", "", "consumer group name")
+	}
+	return fs
+}
+
+func parse(fs *flag.FlagSet, args []string, required ...string) {
+	fs.Parse(args)
+	for _, name := range required {
+		if fs.Lookup(name).Value.String() == "" {
+			fmt.Fprintf(os.Stderr, "-%s is required\n", name)
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+}
+
+func open(ctx context.Context, name string) (*rstream.RedisStream, error) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: password,
+	})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("connect to redis %s: %w", address, err)
+	}
+	stream := rstream.RedisStream{}
+	err := stream.New(&rstream.StreamConfig{Client: rdb, Stream: name})
+	return &stream, err
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+//-1 is unknown
+func orUnknown(n int64) string {
+	if n < 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
+
+func info(ctx context.Context, args []string) error {
+	var name string
+	fs := newFlagSet("info", &name, nil)
+	parse(fs, args, "stream")
+	stream, err := open(ctx, name)
+	if err != nil {
+		return err
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return err
+	}
+	w := newTable()
+	fmt.Fprintf(w, "length\t%d\n", info.Length)
+	fmt.Fprintf(w, "groups\t%d\n", info.Groups)
+	fmt.Fprintf(w, "last-generated-id\t%s\n", info.LastGeneratedID)
+	fmt.Fprintf(w, "first-entry\t%s\n", info.FirstEntryID)
+	fmt.Fprintf(w, "last-entry\t%s\n", info.LastEntryID)
+	return w.Flush()
+}
+
+func groups(ctx context.Context, args []string) error {
+	var name string
+	fs := newFlagSet("groups", &name, nil)
+	parse(fs, args, "stream")
+	stream, err := open(ctx, name)
+	if err != nil {
+		return err
+	}
+	groups, err := stream.Groups(ctx)
+	if err != nil {
+		return err
+	}
+	w := newTable()
+	fmt.Fprintln(w, "GROUP\tCONSUMERS\tPENDING\tLAST-DELIVERED\tLAG")
+	for _, group := range groups {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", group.Name, group.Consumers, group.Pending, group.LastDeliveredID, orUnknown(group.Lag))
+	}
+	return w.Flush()
+}
+
+func consumers(ctx context.Context, args []string) error {
+	var name, group string
+	fs := newFlagSet("consumers", &name, &group)
+	parse(fs, args, "stream", "group")
+	stream, err := open(ctx, name)
+	if err != nil {
+		return err
+	}
+	consumers, err := stream.Consumers(ctx, group)
+	if err != nil {
+		return err
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Idle > consumers[j].Idle })
+	w := newTable()
+	fmt.Fprintln(w, "CONSUMER\tPENDING\tIDLE\tINACTIVE")
+	for _, consumer := range consumers {
+		inactive := "-"
+		if consumer.Inactive >= 0 {
+			inactive = consumer.Inactive.Truncate(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", consumer.Name, consumer.Pending, consumer.Idle.Truncate(time.Second), inactive)
+	}
+	return w.Flush()
+}
+
+func prune(ctx context.Context, args []string) error {
+	var name, group string
+	fs := newFlagSet("prune", &name, &group)
+	idle := fs.Duration("idle", time.Hour, "min idle time of a stale consumer")
+	force := fs.Bool("force", false, "also delete consumers with pending entries, the entries are dropped")
+	dryRun := fs.Bool("dry-run", false, "only print stale consumers")
+	parse(fs, args, "stream", "group")
+	stream, err := open(ctx, name)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		stale, err := stream.StaleConsumers(ctx, group, *idle)
+		if err != nil {
+			return err
+		}
+		for _, consumer := range stale {
+			fmt.Printf("%s\tpending=%d\tidle=%s\n", consumer.Name, consumer.Pending, consumer.Idle.Truncate(time.Second))
+		}
+		return nil
+	}
+	deleted, err := stream.DeleteStaleConsumers(ctx, group, *idle, *force)
+	for _, consumer := range deleted {
+		fmt.Println("deleted", consumer)
+	}
+	return err
+}
+
+func setID(ctx context.Context, args []string) error {
+	var name, group string
+	fs := newFlagSet("setid", &name, &group)
+	id := fs.String("id", "", `new last delivered id, "$" for end of stream, "0" to redeliver all`)
+	parse(fs, args, "stream", "group", "id")
+	stream, err := open(ctx, name)
+	if err != nil {
+		return err
+	}
+	return stream.SetGroupID(ctx, group, *id)
+}
+
+func tail(ctx context.Context, args []string) error {
+	var name string
+	fs := newFlagSet("tail", &name, nil)
+	count := fs.Int64("n", 10, "number of last entries")
+	follow := fs.Bool("f", false, "follow new entries")
+	parse(fs, args, "stream")
+	stream, err := open(ctx, name)
+	if err != nil {
+		return err
+	}
+	msgs, err := stream.Tail(ctx, *count)
+	if err != nil {
+		return err
+	}
+	last := "$"
+	for _, msg := range msgs {
+		printEntry(msg)
+		last = msg.ID
+	}
+	if !*follow {
+		return nil
+	}
+	return stream.Follow(ctx, last, func(msg redis.XMessage) bool {
+		printEntry(msg)
+		return true
+	})
+}
+
+func printEntry(msg redis.XMessage) {
+	keys := make([]string, 0, len(msg.Values))
+	for key := range msg.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		fields[i] = fmt.Sprintf("%s=%v", key, msg.Values[key])
+	}
+	fmt.Printf("%s %s\n", msg.ID, strings.Join(fields, " "))
+}
@@ -0,0 +1,315 @@
+package rstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+//reserved stream fields of typed message
+const (
+	FieldSchema  = "_v"       //schema version, missing means 0
+	FieldCodec   = "_codec"   //payload codec name, missing means struct fields are stream fields
+	FieldPayload = "_payload" //encoded struct when codec is set
+)
+
+var (
+	ErrSchemaVersion = errors.New("message schema version is newer than the type")
+	ErrUnknownCodec  = errors.New("unknown message codec")
+)
+
+//struct field is mapped to stream field by tag `rstream:"name"`, field name is used if no tag
+//and `rstream:"-"` skips the field
+const tagName = "rstream"
+
+//encode whole struct into FieldPayload
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string                               { return "msgpack" }
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+var (
+	JSON    Codec = jsonCodec{}
+	Msgpack Codec = msgpackCodec{}
+)
+
+var codecs = struct {
+	sync.RWMutex
+	m map[string]Codec
+}{m: map[string]Codec{JSON.Name(): JSON, Msgpack.Name(): Msgpack}}
+
+//make codec available to Decode by its name
+func RegisterCodec(codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.m[codec.Name()] = codec
+}
+
+func getCodec(name string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.m[name]
+	return codec, ok
+}
+
+//message type implements Versioned to write FieldSchema,
+//Decode rejects message with a newer version than the type
+type Versioned interface {
+	SchemaVersion() int
+}
+
+type EncodeOption func(*encodeOptions)
+
+type encodeOptions struct {
+	codec Codec
+}
+
+//encode the struct into FieldPayload with codec instead of one stream field per struct field
+func WithCodec(codec Codec) EncodeOption {
+	return func(o *encodeOptions) {
+		o.codec = codec
+	}
+}
+
+//add typed message to stream, return the message id
+func Publish[T any](ctx context.Context, stream *RedisStream, v T, opts ...EncodeOption) (string, error) {
+	values, err := Encode(v, opts...)
+	if err != nil {
+		return "", err
+	}
+	return stream.add(ctx, values)
+}
+
+//encode struct to stream fields
+func Encode(v interface{}, opts ...EncodeOption) (map[string]interface{}, error) {
+	options := encodeOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	values := map[string]interface{}{}
+	if versioned, ok := v.(Versioned); ok {
+		values[FieldSchema] = strconv.Itoa(versioned.SchemaVersion())
+	}
+	if options.codec != nil {
+		payload, err := options.codec.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("marshal payload: %w", err)
+		}
+		values[FieldCodec] = options.codec.Name()
+		values[FieldPayload] = string(payload)
+		return values, nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("encode %T: not a struct", v)
+	}
+	for i, field := range structFields(rv.Type()) {
+		if field.name == "" {
+			continue
+		}
+		value, err := formatField(rv.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("encode field %s: %w", field.name, err)
+		}
+		values[field.name] = value
+	}
+	return values, nil
+}
+
+//decode message into T, never panic on malformed message
+func Decode[T any](msg XMessage) (v T, err error) {
+	if msg.Error != nil {
+		return v, msg.Error
+	}
+	err = DecodeValues(msg.Values, &v)
+	if err != nil {
+		err = fmt.Errorf("decode message %s: %w", msg.ID, err)
+	}
+	return
+}
+
+//decode stream fields into pointer to struct
+func DecodeValues(values map[string]interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode into %T: not a pointer to struct", v)
+	}
+	if versioned, ok := v.(Versioned); ok {
+		version := 0
+		if raw, ok := values[FieldSchema]; ok {
+			s, _ := raw.(string)
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("invalid schema version %v", raw)
+			}
+			version = n
+		}
+		if version > versioned.SchemaVersion() {
+			return fmt.Errorf("%w: %d > %d", ErrSchemaVersion, version, versioned.SchemaVersion())
+		}
+	}
+	if raw, ok := values[FieldCodec]; ok {
+		name, _ := raw.(string)
+		codec, ok := getCodec(name)
+		if !ok {
+			return fmt.Errorf("%w: %v", ErrUnknownCodec, raw)
+		}
+		payload, ok := values[FieldPayload].(string)
+		if !ok {
+			return fmt.Errorf("missing field %s", FieldPayload)
+		}
+		return codec.Unmarshal([]byte(payload), v)
+	}
+	elem := rv.Elem()
+	for i, field := range structFields(elem.Type()) {
+		if field.name == "" {
+			continue
+		}
+		raw, ok := values[field.name]
+		if !ok {
+			continue
+		}
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("field %s is %T, not string", field.name, raw)
+		}
+		if err := parseField(elem.Field(i), s); err != nil {
+			return fmt.Errorf("decode field %s: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+type structField struct {
+	name string //empty if skipped
+}
+
+//stream field name of every struct field, cached by type
+var fieldCache sync.Map
+
+func structFields(t reflect.Type) []structField {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]structField)
+	}
+	fields := make([]structField, t.NumField())
+	for i := range fields {
+		f := t.Field(i)
+		if f.PkgPath != "" { //unexported
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup(tagName); ok {
+			name = strings.Split(tag, ",")[0]
+		}
+		if name == "-" || name == FieldSchema || name == FieldCodec || name == FieldPayload {
+			continue
+		}
+		fields[i].name = name
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func formatField(v reflect.Value) (string, error) {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			return time.Duration(v.Int()).String(), nil
+		}
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type %s, use WithCodec", v.Type())
+}
+
+func parseField(v reflect.Value, s string) error {
+	if v.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type %s, use WithCodec", v.Type())
+		}
+		v.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("unsupported type %s, use WithCodec", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package rstream_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	"github.com/lyineee/go-learn/redis-stream/message"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEvent struct {
+	ID      string        `rstream:"id" json:"id" msgpack:"id"`
+	Count   int           `rstream:"count" json:"count" msgpack:"count"`
+	Ok      bool          `json:"ok" msgpack:"ok"`
+	Delay   time.Duration `rstream:"delay" json:"delay" msgpack:"delay"`
+	At      time.Time     `rstream:"at" json:"at" msgpack:"at"`
+	Skipped string        `rstream:"-" json:"-" msgpack:"-"`
+}
+
+func (testEvent) SchemaVersion() int { return 2 }
+
+func TestEncodeDecode(t *testing.T) {
+	ast := assert.New(t)
+	event := testEvent{ID: "a", Count: 3, Ok: true, Delay: time.Second, At: time.Date(2022, 2, 15, 0, 0, 0, 0, time.UTC), Skipped: "x"}
+
+	values, err := rstream.Encode(event)
+	ast.Nil(err)
+	ast.Equal(map[string]interface{}{"_v": "2", "id": "a", "count": "3", "Ok": "true", "delay": "1s", "at": "2022-02-15T00:00:00Z"}, values)
+	decoded, err := rstream.Decode[testEvent](msgOf(values))
+	ast.Nil(err)
+	event.Skipped = ""
+	ast.Equal(event, decoded)
+
+	for _, codec := range []rstream.Codec{rstream.JSON, rstream.Msgpack} {
+		values, err = rstream.Encode(event, rstream.WithCodec(codec))
+		ast.Nil(err)
+		ast.Equal(codec.Name(), values[rstream.FieldCodec])
+		decoded, err = rstream.Decode[testEvent](msgOf(values))
+		ast.Nil(err, codec.Name())
+		ast.True(event.At.Equal(decoded.At), codec.Name())
+		decoded.At = event.At
+		ast.Equal(event, decoded, codec.Name())
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	ast := assert.New(t)
+	_, err := rstream.Decode[testEvent](msgOf(map[string]interface{}{"count": "three"}))
+	ast.NotNil(err)
+	_, err = rstream.Decode[testEvent](msgOf(map[string]interface{}{"id": 1}))
+	ast.NotNil(err)
+	_, err = rstream.Decode[testEvent](msgOf(map[string]interface{}{"_v": "3", "id": "a"}))
+	ast.True(errors.Is(err, rstream.ErrSchemaVersion))
+	_, err = rstream.Decode[testEvent](msgOf(map[string]interface{}{"_codec": "xml", "_payload": "<a/>"}))
+	ast.True(errors.Is(err, rstream.ErrUnknownCodec))
+
+	//untyped message published before schema version
+	request, err := rstream.Decode[message.RefreshRequest](msgOf(map[string]interface{}{"id": "620b8a"}))
+	ast.Nil(err)
+	ast.Equal("620b8a", request.HistoryID)
+}
+
+func TestPublish(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.publish")
+	group := testGroup(t, rdb, "stream.test.publish", "consumer-1")
+	stream := testStream(t, rdb, "stream.test.publish")
+
+	id, err := rstream.Publish(ctx, &stream, message.RefreshRequest{HistoryID: "620b8a"})
+	ast.Nil(err)
+	ast.NotEmpty(id)
+	msgs, err := group.ReadBatch(ctx, 1, 100*time.Millisecond)
+	ast.Nil(err)
+	ast.Len(msgs, 1)
+	ast.Equal(id, msgs[0].ID)
+	request, err := rstream.Decode[message.RefreshRequest](rstream.XMessage{XMessage: msgs[0]})
+	ast.Nil(err)
+	ast.Equal("620b8a", request.HistoryID)
+}
+
+func msgOf(values map[string]interface{}) rstream.XMessage {
+	msg := rstream.XMessage{}
+	msg.ID = "1-0"
+	msg.Values = values
+	return msg
+}
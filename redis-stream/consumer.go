@@ -0,0 +1,70 @@
+package rstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/lyineee/go-learn/utils/log"
+)
+
+var (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+//exponential backoff between failed reads
+type backoff struct {
+	next time.Duration
+}
+
+//sleep before retry, return false if ctx is done
+func (b *backoff) wait(ctx context.Context) bool {
+	if b.next == 0 {
+		b.next = minBackoff
+	}
+	timer := time.NewTimer(b.next)
+	defer timer.Stop()
+	if b.next *= 2; b.next > maxBackoff {
+		b.next = maxBackoff
+	}
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (b *backoff) reset() {
+	b.next = 0
+}
+
+type Handler func(ctx context.Context, msg XMessage) error
+
+type Consumer struct {
+	group   *ConsumerGroup
+	options []SubscribeOption
+}
+
+func NewConsumer(group *ConsumerGroup, opts ...SubscribeOption) *Consumer {
+	return &Consumer{
+		group:   group,
+		options: opts,
+	}
+}
+
+//handle message one by one until ctx is done, the running handler is not interrupted.
+//handler gets a context which is not canceled with ctx so the last message can finish.
+func (consumer *Consumer) Run(ctx context.Context, handler Handler) error {
+	logger := consumer.group.logger
+	for msg := range consumer.group.Subscribe(ctx, consumer.options...) {
+		if msg.Error != nil {
+			continue
+		}
+		if err := handler(context.Background(), msg); err != nil {
+			logger.Error("handle message fail", log.String("message_id", msg.ID), log.Error(err))
+		}
+	}
+	logger.Info("consumer stopped", log.String("consumer", consumer.group.ConsumerID))
+	return ctx.Err()
+}
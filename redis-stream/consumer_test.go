@@ -0,0 +1,51 @@
+package rstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeCancel(t *testing.T) {
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.cancel")
+	group := testGroup(t, rdb, "stream.test.cancel", "consumer-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	c := group.Subscribe(ctx, rstream.WithBlock(100*time.Millisecond))
+	cancel()
+	select {
+	case _, ok := <-c:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Error("channel not closed after cancel")
+	}
+}
+
+func TestConsumerRun(t *testing.T) {
+	ast := assert.New(t)
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.run")
+	group := testGroup(t, rdb, "stream.test.run", "consumer-1")
+	stream := testStream(t, rdb, "stream.test.run")
+	stream.Add(context.Background(), map[string]interface{}{"id": "1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	consumer := rstream.NewConsumer(&group, rstream.WithBlock(100*time.Millisecond))
+	err := consumer.Run(ctx, func(handlerCtx context.Context, msg rstream.XMessage) error {
+		cancel() //shutdown while handling
+		time.Sleep(50 * time.Millisecond)
+		ast.Nil(handlerCtx.Err())
+		close(done)
+		return group.Ack(handlerCtx, msg.ID)
+	})
+	ast.Equal(context.Canceled, err)
+	select {
+	case <-done:
+	default:
+		t.Error("handler not finished before Run return")
+	}
+}
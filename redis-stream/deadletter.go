@@ -0,0 +1,236 @@
+package rstream
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lyineee/go-learn/utils/log"
+)
+
+//fields added to the entry when moved to dead letter stream
+const (
+	deadLetterPrefix   = "dlq."
+	deadLetterID       = deadLetterPrefix + "id"
+	deadLetterStream   = deadLetterPrefix + "stream"
+	deadLetterGroup    = deadLetterPrefix + "group"
+	deadLetterConsumer = deadLetterPrefix + "consumer"
+	deadLetterDelivery = deadLetterPrefix + "delivery"
+	deadLetterError    = deadLetterPrefix + "error"
+)
+
+var deadLetterScanCount int64 = 100
+
+//dead letters are kept until replayed or purged, the bound only stops a flood of poison messages
+const defaultDeadLetterMaxLen = 10000
+
+type DeadLetter struct {
+	ID       string //id in dead letter stream
+	OriginID string //id in origin stream
+	Stream   string
+	Group    string
+	Consumer string
+	Delivery int64
+	Error    string
+	Values   map[string]interface{}
+}
+
+//hash of message id to the last error reported by Nack
+func (group *ConsumerGroup) errorKey() string {
+	return group.stream + ":" + group.group + ":error"
+}
+
+//leave the message pending and record the error for dead letter
+func (group *ConsumerGroup) Nack(ctx context.Context, id string, cause error) (err error) {
+	group.logger.Info("nack message", log.String("message_id", id), log.Error(cause))
+	if group.MaxDelivery <= 0 || cause == nil {
+		return nil
+	}
+	err = group.client.HSet(ctx, group.errorKey(), id, cause.Error()).Err()
+	if err != nil {
+		group.logger.Error("fail to record message error", log.String("message_id", id), log.Error(err))
+	}
+	return
+}
+
+//move pending entries delivered more than MaxDelivery times to dead letter stream
+func (group *ConsumerGroup) MoveDeadLetters(ctx context.Context) (moved int, err error) {
+	if group.MaxDelivery <= 0 {
+		return 0, nil
+	}
+	start := "-"
+	for {
+		pending, err := group.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: group.stream,
+			Group:  group.group,
+			Start:  start,
+			End:    "+",
+			Count:  deadLetterScanCount,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return moved, err
+		}
+		for _, entry := range pending {
+			if entry.RetryCount <= group.MaxDelivery {
+				continue
+			}
+			if err := group.deadLetter(ctx, entry); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+		if int64(len(pending)) < deadLetterScanCount {
+			break
+		}
+		start = "(" + pending[len(pending)-1].ID
+	}
+	if moved != 0 {
+		group.logger.Info("move message to dead letter stream", log.String("dead_letter_stream", group.DeadLetterStream), log.Int("count", moved))
+	}
+	return moved, nil
+}
+
+//dead letter sweep inside consume loop, report error to handle
+func (group *ConsumerGroup) moveDeadLetters(ctx context.Context, handle func(msgs []redis.XMessage, err error) bool) bool {
+	if _, err := group.MoveDeadLetters(ctx); err != nil && ctx.Err() == nil {
+		group.logger.Error("move dead letter fail", log.Error(err))
+		return handle(nil, err)
+	}
+	return ctx.Err() == nil
+}
+
+func (group *ConsumerGroup) deadLetter(ctx context.Context, entry redis.XPendingExt) error {
+	values := map[string]interface{}{}
+	origin := map[string]interface{}{}
+	msgs, err := group.client.XRangeN(ctx, group.stream, entry.ID, entry.ID, 1).Result()
+	if err != nil {
+		return err
+	}
+	if len(msgs) != 0 {
+		for key, value := range msgs[0].Values {
+			values[key] = value
+			origin[key] = value
+		}
+	}
+	cause, err := group.client.HGet(ctx, group.errorKey(), entry.ID).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	values[deadLetterID] = entry.ID
+	values[deadLetterStream] = group.stream
+	values[deadLetterGroup] = group.group
+	values[deadLetterConsumer] = entry.Consumer
+	values[deadLetterDelivery] = entry.RetryCount
+	values[deadLetterError] = cause
+	args := &redis.XAddArgs{
+		Stream: group.DeadLetterStream,
+		ID:     "*",
+		Values: values,
+	}
+	group.DeadLetterRetention.apply(args)
+	id, err := group.client.XAdd(ctx, args).Result()
+	if err != nil {
+		return err
+	}
+	group.logger.Info("dead letter", log.String("message_id", entry.ID), log.Any("delivery", entry.RetryCount), log.String("error", cause))
+	if err = group.Ack(ctx, entry.ID); err != nil {
+		return err
+	}
+	if group.OnDeadLetter != nil {
+		group.OnDeadLetter(ctx, DeadLetter{
+			ID:       id,
+			OriginID: entry.ID,
+			Stream:   group.stream,
+			Group:    group.group,
+			Consumer: entry.Consumer,
+			Delivery: entry.RetryCount,
+			Error:    cause,
+			Values:   origin,
+		})
+	}
+	return nil
+}
+
+//list entries in dead letter stream, oldest first
+func (group *ConsumerGroup) DeadLetters(ctx context.Context, count int64) (letters []DeadLetter, err error) {
+	msgs, err := group.client.XRangeN(ctx, group.DeadLetterStream, "-", "+", count).Result()
+	if err != nil {
+		return
+	}
+	for _, msg := range msgs {
+		letters = append(letters, parseDeadLetter(msg))
+	}
+	return
+}
+
+//add dead letters back to their origin stream and remove them from dead letter stream
+func (group *ConsumerGroup) ReplayDeadLetters(ctx context.Context, ids ...string) (replayed int, err error) {
+	for _, id := range ids {
+		msgs, err := group.client.XRangeN(ctx, group.DeadLetterStream, id, id, 1).Result()
+		if err != nil {
+			return replayed, err
+		}
+		if len(msgs) == 0 {
+			group.logger.Info("dead letter not found", log.String("id", id))
+			continue
+		}
+		letter := parseDeadLetter(msgs[0])
+		stream := letter.Stream
+		if stream == "" {
+			stream = group.stream
+		}
+		//letters come from the group stream, so its retention is applied
+		args := group.addArgs(letter.Values)
+		args.Stream = stream
+		_, err = group.client.XAdd(ctx, args).Result()
+		if err != nil {
+			return replayed, err
+		}
+		if err = group.client.XDel(ctx, group.DeadLetterStream, id).Err(); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+//remove dead letters, remove the whole dead letter stream if no id given
+func (group *ConsumerGroup) PurgeDeadLetters(ctx context.Context, ids ...string) (purged int64, err error) {
+	if len(ids) == 0 {
+		purged, err = group.client.XLen(ctx, group.DeadLetterStream).Result()
+		if err != nil {
+			return
+		}
+		err = group.client.Del(ctx, group.DeadLetterStream).Err()
+		return
+	}
+	return group.client.XDel(ctx, group.DeadLetterStream, ids...).Result()
+}
+
+func parseDeadLetter(msg redis.XMessage) (letter DeadLetter) {
+	letter.ID = msg.ID
+	letter.Values = map[string]interface{}{}
+	for key, value := range msg.Values {
+		str, _ := value.(string)
+		switch key {
+		case deadLetterID:
+			letter.OriginID = str
+		case deadLetterStream:
+			letter.Stream = str
+		case deadLetterGroup:
+			letter.Group = str
+		case deadLetterConsumer:
+			letter.Consumer = str
+		case deadLetterDelivery:
+			letter.Delivery, _ = strconv.ParseInt(str, 10, 64)
+		case deadLetterError:
+			letter.Error = str
+		default:
+			if !strings.HasPrefix(key, deadLetterPrefix) {
+				letter.Values[key] = value
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package rstream_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetter(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.poison")
+	resetStream(t, rdb, "stream.test.poison.dlq")
+	group := testGroup(t, rdb, "stream.test.poison", "consumer-1")
+	group.MaxDelivery = 1
+	ast.Equal(rstream.Retention{MaxLen: 10000}, group.DeadLetterRetention) //dead letter stream is bounded by default
+	var dead []rstream.DeadLetter
+	group.OnDeadLetter = func(ctx context.Context, letter rstream.DeadLetter) { dead = append(dead, letter) }
+	stream := testStream(t, rdb, "stream.test.poison")
+	stream.Add(ctx, map[string]interface{}{"id": "poison"})
+
+	msgs, err := group.Get(1)
+	ast.Nil(err)
+	ast.Nil(group.Nack(ctx, msgs[0].ID, errors.New("parse url fail")))
+	moved, err := group.MoveDeadLetters(ctx)
+	ast.Nil(err)
+	ast.Equal(0, moved)
+
+	_, err = group.DrainPending(ctx) //second delivery
+	ast.Nil(err)
+	moved, err = group.MoveDeadLetters(ctx)
+	ast.Nil(err)
+	ast.Equal(1, moved)
+	pending, err := group.Pending(ctx, "", 10)
+	ast.Nil(err)
+	ast.Len(pending, 0)
+
+	letters, err := group.DeadLetters(ctx, 10)
+	ast.Nil(err)
+	if ast.Len(letters, 1) {
+		ast.Equal(msgs[0].ID, letters[0].OriginID)
+		ast.Equal("parse url fail", letters[0].Error)
+		ast.Equal(int64(2), letters[0].Delivery)
+		ast.Equal(map[string]interface{}{"id": "poison"}, letters[0].Values)
+		ast.Equal(letters, dead)
+	}
+
+	replayed, err := group.ReplayDeadLetters(ctx, letters[0].ID)
+	ast.Nil(err)
+	ast.Equal(1, replayed)
+	msgs, err = group.Get(1)
+	ast.Nil(err)
+	ast.Equal(map[string]interface{}{"id": "poison"}, msgs[0].Values)
+
+	purged, err := group.PurgeDeadLetters(ctx)
+	ast.Nil(err)
+	ast.Equal(int64(0), purged)
+}
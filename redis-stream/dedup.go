@@ -0,0 +1,151 @@
+package rstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lyineee/go-learn/utils/log"
+)
+
+//keys with expiry in redis, used to publish or handle a message at most once in Window
+type Dedup struct {
+	client *redis.Client
+	prefix string
+	Window time.Duration //expiry of a claimed id, 0 means never expire
+	logger *log.Logger
+}
+
+func NewDedup(client *redis.Client, prefix string, window time.Duration) *Dedup {
+	return &Dedup{
+		client: client,
+		prefix: prefix,
+		Window: window,
+		logger: log.Default(),
+	}
+}
+
+func (dedup *Dedup) key(id string) string {
+	return dedup.prefix + ":" + id
+}
+
+//return true if id is not claimed in Window, otherwise it's a duplicate
+func (dedup *Dedup) Claim(ctx context.Context, id string) (bool, error) {
+	ok, err := dedup.client.SetNX(ctx, dedup.key(id), time.Now().Unix(), dedup.Window).Result()
+	if err != nil {
+		dedup.logger.Error("claim dedup key fail", log.String("key", dedup.key(id)), log.Error(err))
+	}
+	return ok, err
+}
+
+//whether each id is claimed, without claiming it
+func (dedup *Dedup) Claimed(ctx context.Context, ids ...string) ([]bool, error) {
+	cmds := make([]*redis.IntCmd, len(ids))
+	_, err := dedup.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.Exists(ctx, dedup.key(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claimed := make([]bool, len(ids))
+	for i, cmd := range cmds {
+		claimed[i] = cmd.Val() == 1
+	}
+	return claimed, nil
+}
+
+//release claimed ids so they can be claimed again before Window ends
+func (dedup *Dedup) Release(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = dedup.key(id)
+	}
+	err := dedup.client.Del(ctx, keys...).Err()
+	if err != nil {
+		dedup.logger.Error("release dedup key fail", log.Any("keys", keys), log.Error(err))
+	}
+	return err
+}
+
+//publish v only if id is not claimed, the claim is released if publish fails.
+//return empty message id and no error for a duplicate
+func PublishOnce[T any](ctx context.Context, stream *RedisStream, dedup *Dedup, id string, v T, opts ...EncodeOption) (string, error) {
+	ok, err := dedup.Claim(ctx, id)
+	if err != nil || !ok {
+		return "", err
+	}
+	msgID, err := Publish(ctx, stream, v, opts...)
+	if err != nil {
+		dedup.Release(ctx, id)
+	}
+	return msgID, err
+}
+
+//result of one message of PublishOnceBatch
+type PublishResult struct {
+	ID  string //empty for a duplicate or error
+	Err error
+}
+
+//PublishOnce of many messages, claims and XADDs are pipelined in two round trips.
+//ids[i] is the dedup id of vs[i], error of each message is in its result
+func PublishOnceBatch[T any](ctx context.Context, stream *RedisStream, dedup *Dedup, ids []string, vs []T, opts ...EncodeOption) ([]PublishResult, error) {
+	if len(ids) != len(vs) {
+		return nil, fmt.Errorf("%d dedup ids for %d messages", len(ids), len(vs))
+	}
+	results := make([]PublishResult, len(vs))
+	values := make([]map[string]interface{}, len(vs))
+	for i, v := range vs {
+		values[i], results[i].Err = Encode(v, opts...)
+	}
+	claims := make([]*redis.BoolCmd, len(ids))
+	_, err := dedup.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		now := time.Now().Unix()
+		for i, id := range ids {
+			if results[i].Err == nil {
+				claims[i] = pipe.SetNX(ctx, dedup.key(id), now, dedup.Window)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		dedup.logger.Error("claim dedup keys fail", log.Int("count", len(ids)), log.Error(err))
+	}
+	adds := make([]*redis.StringCmd, len(vs))
+	_, err = stream.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, claim := range claims {
+			if claim == nil {
+				continue
+			}
+			if claim.Err() != nil {
+				results[i].Err = claim.Err()
+			} else if claim.Val() {
+				adds[i] = pipe.XAdd(ctx, stream.addArgs(values[i]))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		stream.logger.Error("pipelined xadd fail", log.Int("count", len(vs)), log.Error(err))
+	}
+	var release []string
+	for i, add := range adds {
+		if add == nil {
+			continue
+		}
+		if results[i].ID, results[i].Err = add.Result(); results[i].Err != nil {
+			release = append(release, ids[i])
+		}
+	}
+	if len(release) != 0 {
+		dedup.Release(ctx, release...)
+	}
+	return results, nil
+}
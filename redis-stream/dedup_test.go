@@ -0,0 +1,96 @@
+package rstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	"github.com/lyineee/go-learn/redis-stream/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedup(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	dedup := rstream.NewDedup(rdb, "test.dedup", time.Minute)
+	t.Cleanup(func() { dedup.Release(ctx, "a") })
+
+	ok, err := dedup.Claim(ctx, "a")
+	ast.Nil(err)
+	ast.True(ok)
+	ok, err = dedup.Claim(ctx, "a")
+	ast.Nil(err)
+	ast.False(ok)
+	claimed, err := dedup.Claimed(ctx, "a", "b")
+	ast.Nil(err)
+	ast.Equal([]bool{true, false}, claimed)
+	ast.Nil(dedup.Release(ctx, "a"))
+	ok, err = dedup.Claim(ctx, "a")
+	ast.Nil(err)
+	ast.True(ok)
+	ttl, err := rdb.TTL(ctx, "test.dedup:a").Result()
+	ast.Nil(err)
+	ast.True(ttl > 0 && ttl <= time.Minute)
+}
+
+func TestPublishOnce(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.publish-once")
+	stream := testStream(t, rdb, "stream.test.publish-once")
+	pending := rstream.NewDedup(rdb, "test.pending", time.Minute)
+	t.Cleanup(func() { pending.Release(ctx, "620b8a") })
+
+	request := message.RefreshRequest{HistoryID: "620b8a"}
+	id, err := rstream.PublishOnce(ctx, &stream, pending, request.HistoryID, request)
+	ast.Nil(err)
+	ast.NotEmpty(id)
+	id, err = rstream.PublishOnce(ctx, &stream, pending, request.HistoryID, request)
+	ast.Nil(err)
+	ast.Empty(id)
+	ast.Equal(int64(1), rdb.XLen(ctx, "stream.test.publish-once").Val())
+
+	pending.Release(ctx, request.HistoryID) //handled by consumer
+	id, err = rstream.PublishOnce(ctx, &stream, pending, request.HistoryID, request)
+	ast.Nil(err)
+	ast.NotEmpty(id)
+}
+
+func TestPublishOnceBatch(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.publish-once-batch")
+	stream := testStream(t, rdb, "stream.test.publish-once-batch")
+	pending := rstream.NewDedup(rdb, "test.pending", time.Minute)
+	ids := []string{"620b8a", "620b8b", "620b8c"}
+	t.Cleanup(func() { pending.Release(ctx, ids...) })
+
+	_, err := pending.Claim(ctx, "620b8b") //pending refresh
+	ast.Nil(err)
+	requests := make([]message.RefreshRequest, len(ids))
+	for i, id := range ids {
+		requests[i] = message.RefreshRequest{HistoryID: id, Priority: i}
+	}
+	results, err := rstream.PublishOnceBatch(ctx, &stream, pending, ids, requests)
+	ast.Nil(err)
+	ast.Len(results, 3)
+	ast.NotEmpty(results[0].ID)
+	ast.Empty(results[1].ID)
+	ast.NotEmpty(results[2].ID)
+	for _, result := range results {
+		ast.Nil(result.Err)
+	}
+	ast.Equal(int64(2), rdb.XLen(ctx, "stream.test.publish-once-batch").Val())
+
+	msgs := rdb.XRange(ctx, "stream.test.publish-once-batch", "-", "+").Val()
+	request, err := rstream.Decode[message.RefreshRequest](rstream.XMessage{XMessage: msgs[1]})
+	ast.Nil(err)
+	ast.Equal(requests[2], request)
+
+	_, err = rstream.PublishOnceBatch(ctx, &stream, pending, ids[:1], requests)
+	ast.NotNil(err)
+}
@@ -3,6 +3,8 @@ package rstream
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
@@ -10,26 +12,36 @@ import (
 )
 
 type StreamConfig struct {
-	Client *redis.Client
-	Stream string
-	logger *log.Logger
+	Client    *redis.Client
+	Stream    string
+	Retention Retention
+	logger    *log.Logger
 }
 type RedisStream struct {
-	client *redis.Client
-	stream string
-	logger *log.Logger
+	client    *redis.Client
+	stream    string
+	retention Retention
+	logger    *log.Logger
 }
 
 type GroupConfig struct {
-	Group      string
-	ConsumerID string
+	Group               string
+	ConsumerID          string
+	MaxDelivery         int64     //move entry to dead letter stream after delivered more than MaxDelivery times, 0 means no limit
+	DeadLetterStream    string    //dead letter stream name, default to <stream>.dlq
+	DeadLetterRetention Retention //retention of dead letter stream, default to MaxLen 10000
+	OnDeadLetter        func(ctx context.Context, letter DeadLetter)
 	StreamConfig
 }
 
 type ConsumerGroup struct {
 	RedisStream
-	group      string
-	ConsumerID string
+	group               string
+	ConsumerID          string
+	MaxDelivery         int64
+	DeadLetterStream    string
+	DeadLetterRetention Retention
+	OnDeadLetter        func(ctx context.Context, letter DeadLetter) //called after a message is moved to dead letter stream
 }
 
 type XMessage struct {
@@ -40,6 +52,7 @@ type XMessage struct {
 func (stream *RedisStream) New(config *StreamConfig) (err error) {
 	stream.client = config.Client
 	stream.stream = config.Stream
+	stream.retention = config.Retention
 	if config.logger != nil {
 		stream.logger = config.logger
 	} else {
@@ -66,19 +79,28 @@ func NewStream(ctx context.Context, redisAddress, password, streamName string) (
 }
 
 func (stream *RedisStream) Add(ctx context.Context, value map[string]interface{}) error {
-	result, err := stream.client.XAdd(ctx, &redis.XAddArgs{
+	_, err := stream.add(ctx, value)
+	return err
+}
+
+//XADD with retention policy, return id of the new entry
+func (stream *RedisStream) add(ctx context.Context, value map[string]interface{}) (string, error) {
+	result, err := stream.client.XAdd(ctx, stream.addArgs(value)).Result()
+	if err != nil {
+		stream.logger.Error("error", log.Error(err))
+	}
+	return result, err
+}
+
+func (stream *RedisStream) addArgs(value map[string]interface{}) *redis.XAddArgs {
+	args := &redis.XAddArgs{
 		Stream:     stream.stream,
 		NoMkStream: false,
 		ID:         "*",
 		Values:     value,
-	}).Result()
-	if err != nil {
-		stream.logger.Error("error", log.Error(err))
-	}
-	if result == "0" { //TODO validate result value
-		stream.logger.Info("result is 0")
 	}
-	return nil
+	stream.retention.apply(args)
+	return args
 }
 
 //constructor
@@ -86,6 +108,7 @@ func (group *ConsumerGroup) New(config *GroupConfig) (err error) {
 	group.client = config.Client
 	group.group = config.Group
 	group.stream = config.Stream
+	group.retention = config.Retention
 	if config.logger != nil {
 		group.logger = config.logger
 	} else {
@@ -95,6 +118,14 @@ func (group *ConsumerGroup) New(config *GroupConfig) (err error) {
 		group.ConsumerID = uuid.NewString()
 
 	}
+	group.MaxDelivery = config.MaxDelivery
+	if group.DeadLetterStream = config.DeadLetterStream; group.DeadLetterStream == "" {
+		group.DeadLetterStream = group.stream + ".dlq"
+	}
+	if group.DeadLetterRetention = config.DeadLetterRetention; group.DeadLetterRetention == (Retention{}) {
+		group.DeadLetterRetention = Retention{MaxLen: defaultDeadLetterMaxLen}
+	}
+	group.OnDeadLetter = config.OnDeadLetter
 	return nil
 }
 
@@ -123,16 +154,15 @@ func NewGroup(ctx context.Context, redisAddress, password, groupName, streamName
 }
 
 func (group *ConsumerGroup) CreateGroup(ctx context.Context) error {
-	groupInfos, err := group.client.XInfoGroups(ctx, group.stream).Result()
+	_, err := group.Group(ctx, group.group)
 	if err == nil {
-		for _, info := range groupInfos {
-			if info.Name == group.group {
-				return nil
-			}
-		}
+		return nil
 	}
 	group.logger.Info(fmt.Sprintf("group %s not found in stream %s", group.group, group.stream))
 	result, err := group.client.XGroupCreateMkStream(ctx, group.stream, group.group, "$").Result()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") { //created by other consumer
+		return nil
+	}
 	if err != nil {
 		group.logger.Error("error when create group", log.Any("group_options", group.group), log.Error(err))
 		return err
@@ -141,35 +171,102 @@ func (group *ConsumerGroup) CreateGroup(ctx context.Context) error {
 	return nil
 }
 
-func (group *ConsumerGroup) Subscribe() (c chan XMessage) {
+//subscribe group message, the channel is closed when ctx is done
+func (group *ConsumerGroup) Subscribe(ctx context.Context, opts ...SubscribeOption) (c chan XMessage) {
 	c = make(chan XMessage)
 	go func(c chan XMessage) {
-		for {
-			msgs, err := group.Get(1)
+		defer close(c)
+		group.consume(ctx, 1, opts, func(msgs []redis.XMessage, err error) bool {
 			if err != nil {
-				group.logger.Error("read redis group fail", log.Error(err))
-				c <- XMessage{Error: err}
+				msgs = []redis.XMessage{{}}
 			}
 			for _, msg := range msgs {
-				//group.logger.Debug("get message", log.Any("message", msg))
-				c <- XMessage{XMessage: msg}
+				select {
+				case c <- XMessage{XMessage: msg, Error: err}:
+				case <-ctx.Done():
+					return false
+				}
 			}
-		}
+			return true
+		})
 	}(c)
 	return
 }
 
+//read loop of Subscribe and BatchConsumer, return when ctx is done or handle return false
+func (group *ConsumerGroup) consume(ctx context.Context, count int64, opts []SubscribeOption, handle func(msgs []redis.XMessage, err error) bool) {
+	options := subscribeOptions{block: defaultBlock}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	block := options.block
+	if options.reclaimIdle > 0 && options.reclaimIdle < block {
+		block = options.reclaimIdle
+	}
+	retry := backoff{}
+	if !group.moveDeadLetters(ctx, handle) {
+		return
+	}
+	if options.pending {
+		msgs, err := group.DrainPending(ctx)
+		if err != nil {
+			group.logger.Error("read pending list fail", log.Error(err))
+		}
+		if !handle(msgs, err) {
+			return
+		}
+	}
+	var lastReclaim time.Time // zero value, reclaim on first loop
+	for ctx.Err() == nil {
+		if options.reclaimIdle > 0 && time.Since(lastReclaim) >= options.reclaimIdle {
+			lastReclaim = time.Now()
+			if !group.moveDeadLetters(ctx, handle) {
+				return
+			}
+			msgs, err := group.ReclaimIdle(ctx, options.reclaimIdle, options.reclaimCount)
+			if err != nil {
+				group.logger.Error("reclaim idle message fail", log.Error(err))
+			}
+			if !handle(msgs, err) {
+				return
+			}
+		}
+		msgs, err := group.read(ctx, ">", count, block)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			group.logger.Error("read redis group fail", log.Error(err))
+			if !handle(nil, err) || !retry.wait(ctx) {
+				return
+			}
+			continue
+		}
+		retry.reset()
+		if len(msgs) != 0 && !handle(msgs, nil) {
+			return
+		}
+	}
+}
+
 func (group *ConsumerGroup) Get(count int64) (message []redis.XMessage, err error) {
-	ctx := context.Background()
+	return group.read(context.Background(), ">", count, 0)
+}
+
+//read group with id ">" for new message or id from own pending list, block < 0 means no block
+func (group *ConsumerGroup) read(ctx context.Context, id string, count int64, block time.Duration) (message []redis.XMessage, err error) {
 	group.logger.Info("waiting for group message", log.String("stream", group.stream), log.String("group", group.group))
 	stream, err := group.client.XReadGroup(ctx, &redis.XReadGroupArgs{
 		Group:    group.group,
-		Streams:  []string{group.stream, ">"},
+		Streams:  []string{group.stream, id},
 		Consumer: group.ConsumerID,
 		Count:    count,
-		Block:    0,
+		Block:    block,
 		NoAck:    false,
 	}).Result()
+	if err == redis.Nil { //block timeout
+		return nil, nil
+	}
 	if err != nil {
 		return
 	}
@@ -196,5 +293,12 @@ func (group *ConsumerGroup) Ack(ctx context.Context, id string) (err error) {
 	if result == 0 {
 		group.logger.Info("ack already done", log.String("message_id", id))
 	}
+	if group.MaxDelivery > 0 {
+		group.client.HDel(ctx, group.errorKey(), id)
+	}
 	return
 }
+
+func (stream *RedisStream) Client() *redis.Client {
+	return stream.client
+}
@@ -1 +1,57 @@
 package rstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	rstream "github.com/lyineee/go-learn/redis-stream"
+)
+
+//connect to local redis, skip the test if not running
+func testClient(t *testing.T) *redis.Client {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("redis not available", err)
+	}
+	return rdb
+}
+
+//remove the stream before and after test
+func resetStream(t *testing.T, rdb *redis.Client, stream string) {
+	rdb.Del(context.Background(), stream)
+	t.Cleanup(func() { rdb.Del(context.Background(), stream) })
+}
+
+func testGroup(t *testing.T, rdb *redis.Client, stream, consumer string) rstream.ConsumerGroup {
+	ctx := context.Background()
+	group := rstream.ConsumerGroup{}
+	err := group.New(&rstream.GroupConfig{
+		Group:      "test.workers",
+		ConsumerID: consumer,
+		StreamConfig: rstream.StreamConfig{
+			Client: rdb,
+			Stream: stream,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = group.CreateGroup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return group
+}
+
+func testStream(t *testing.T, rdb *redis.Client, stream string) rstream.RedisStream {
+	s := rstream.RedisStream{}
+	if err := s.New(&rstream.StreamConfig{Client: rdb, Stream: stream}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,20 @@
+//messages shared by producers and consumers of the same stream
+package message
+
+//stream of RefreshRequest
+const RefreshStream = "backend.history.refresh"
+
+//ask history-crawl to refresh one history, published by history-publisher
+type RefreshRequest struct {
+	HistoryID string `rstream:"id"`       //mongodb object id in hex
+	Priority  int    `rstream:"priority"` //higher is hotter, consumers may refresh it first
+}
+
+//version 0 is the untyped {"id": hex} message
+func (RefreshRequest) SchemaVersion() int { return 1 }
+
+//dedup key prefixes of RefreshRequest, followed by ":<history id>"
+const (
+	RefreshPendingPrefix = "backend.history.refresh.pending" //set by publisher, deleted by crawler when handled
+	RefreshDedupPrefix   = "backend.history.refresh.dedup"   //set by crawler when crawling
+)
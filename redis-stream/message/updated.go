@@ -0,0 +1,23 @@
+package message
+
+import "time"
+
+//stream of ThreadUpdated
+const ThreadUpdatedStream = "backend.history.updated"
+
+//total page of a followed thread grew, published by history-crawl
+type ThreadUpdated struct {
+	HistoryID    string    `rstream:"id"`
+	Type         string    `rstream:"type"`
+	Url          string    `rstream:"url"`
+	UnreadUrl    string    `rstream:"unread_url"` //first page with new replies
+	Owner        string    `rstream:"owner"`      //owner id in hex, empty if no owner
+	Title        string    `rstream:"title"`
+	OldTotalPage int       `rstream:"old_total_page"`
+	NewTotalPage int       `rstream:"new_total_page"`
+	ReplyCount   int       `rstream:"reply_count"`
+	LastReplyAt  time.Time `rstream:"last_reply_at"`
+	CrawledAt    time.Time `rstream:"crawled_at"`
+}
+
+func (ThreadUpdated) SchemaVersion() int { return 1 }
@@ -0,0 +1,167 @@
+package rstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lyineee/go-learn/utils/log"
+)
+
+var defaultReclaimCount int64 = 100
+
+//poll interval of Subscribe, a blocking read can not be interrupted by ctx
+var defaultBlock = 5 * time.Second
+
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	pending      bool
+	reclaimIdle  time.Duration
+	reclaimCount int64
+	block        time.Duration
+}
+
+//max time a read blocks before checking ctx and reclaim again
+func WithBlock(block time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.block = block
+	}
+}
+
+//deliver the consumer's own pending entries before waiting for new message
+func WithPending() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.pending = true
+	}
+}
+
+//claim entries idle longer than minIdle from other consumers, checked every minIdle
+func WithReclaim(minIdle time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.reclaimIdle = minIdle
+		if o.reclaimCount == 0 {
+			o.reclaimCount = defaultReclaimCount
+		}
+	}
+}
+
+//max entries claimed by one reclaim round
+func WithReclaimCount(count int64) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.reclaimCount = count
+	}
+}
+
+//pending entries of the group, all consumers if consumer is empty
+func (group *ConsumerGroup) Pending(ctx context.Context, consumer string, count int64) ([]redis.XPendingExt, error) {
+	pending, err := group.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   group.stream,
+		Group:    group.group,
+		Start:    "-",
+		End:      "+",
+		Count:    count,
+		Consumer: consumer,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return pending, err
+}
+
+//read all entries delivered to this consumer but not acked yet
+func (group *ConsumerGroup) DrainPending(ctx context.Context) (messages []redis.XMessage, err error) {
+	start := "0"
+	for {
+		msgs, err := group.read(ctx, start, defaultReclaimCount, -1)
+		if err != nil {
+			return messages, err
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		for _, msg := range msgs {
+			if msg.Values == nil { //entry deleted from stream, nothing to process
+				group.Ack(ctx, msg.ID)
+				continue
+			}
+			messages = append(messages, msg)
+		}
+		start = msgs[len(msgs)-1].ID
+	}
+	if len(messages) != 0 {
+		group.logger.Info("get pending message", log.String("consumer", group.ConsumerID), log.Int("count", len(messages)))
+	}
+	return messages, nil
+}
+
+//claim entries idle longer than minIdle to this consumer with XAUTOCLAIM
+func (group *ConsumerGroup) ReclaimIdle(ctx context.Context, minIdle time.Duration, count int64) (messages []redis.XMessage, err error) {
+	start := "0-0"
+	for count <= 0 || int64(len(messages)) < count {
+		var claimCount int64
+		if count > 0 {
+			claimCount = count - int64(len(messages))
+		}
+		next, msgs, deleted, err := group.xAutoClaim(ctx, minIdle, start, claimCount)
+		if err != nil {
+			return messages, err
+		}
+		for _, id := range deleted {
+			group.Ack(ctx, id)
+		}
+		messages = append(messages, msgs...)
+		if next == "0-0" {
+			break
+		}
+		start = next
+	}
+	if len(messages) != 0 {
+		group.logger.Info("reclaim idle message", log.String("consumer", group.ConsumerID), log.Int("count", len(messages)))
+	}
+	return messages, nil
+}
+
+//go-redis v8 XAutoClaim can not parse the 3 element reply of redis 7, parse it here
+func (group *ConsumerGroup) xAutoClaim(ctx context.Context, minIdle time.Duration, start string, count int64) (next string, messages []redis.XMessage, deleted []string, err error) {
+	args := []interface{}{"xautoclaim", group.stream, group.group, group.ConsumerID, int64(minIdle / time.Millisecond), start}
+	if count > 0 {
+		args = append(args, "count", count)
+	}
+	reply, err := group.client.Do(ctx, args...).Slice()
+	if err != nil {
+		return
+	}
+	if len(reply) < 2 {
+		return "", nil, nil, fmt.Errorf("unexpected xautoclaim reply length %d", len(reply))
+	}
+	next, ok := reply[0].(string)
+	if !ok {
+		return "", nil, nil, errors.New("unexpected xautoclaim cursor")
+	}
+	entries, _ := reply[1].([]interface{})
+	for _, entry := range entries {
+		item, ok := entry.([]interface{})
+		if !ok || len(item) != 2 {
+			continue
+		}
+		id, _ := item[0].(string)
+		fields, ok := item[1].([]interface{})
+		if !ok { //redis 6.2 return nil fields for deleted entry
+			deleted = append(deleted, id)
+			continue
+		}
+		values := make(map[string]interface{}, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, _ := fields[i].(string)
+			values[key] = fields[i+1]
+		}
+		messages = append(messages, redis.XMessage{ID: id, Values: values})
+	}
+	if len(reply) > 2 { //redis 7 return deleted ids, already removed from pending list
+		group.logger.Info("xautoclaim skip deleted entries", log.Any("deleted", reply[2]))
+	}
+	return next, messages, deleted, nil
+}
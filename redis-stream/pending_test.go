@@ -0,0 +1,77 @@
+package rstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainPending(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.pending")
+	group := testGroup(t, rdb, "stream.test.pending", "consumer-1")
+	stream := testStream(t, rdb, "stream.test.pending")
+	for i := 0; i < 3; i++ {
+		stream.Add(ctx, map[string]interface{}{"id": i})
+	}
+	msgs, err := group.Get(2)
+	ast.Nil(err)
+	ast.Len(msgs, 2)
+
+	pending, err := group.DrainPending(ctx)
+	ast.Nil(err)
+	ast.Equal(msgs, pending)
+}
+
+func TestReclaimIdle(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.reclaim")
+	crashed := testGroup(t, rdb, "stream.test.reclaim", "consumer-crashed")
+	stream := testStream(t, rdb, "stream.test.reclaim")
+	stream.Add(ctx, map[string]interface{}{"id": "1"})
+	msgs, err := crashed.Get(1)
+	ast.Nil(err)
+
+	group := testGroup(t, rdb, "stream.test.reclaim", "consumer-2")
+	claimed, err := group.ReclaimIdle(ctx, time.Hour, 10)
+	ast.Nil(err)
+	ast.Len(claimed, 0)
+
+	time.Sleep(100 * time.Millisecond)
+	claimed, err = group.ReclaimIdle(ctx, 50*time.Millisecond, 10)
+	ast.Nil(err)
+	ast.Equal(msgs, claimed)
+	pending, err := group.Pending(ctx, "consumer-2", 10)
+	ast.Nil(err)
+	ast.Len(pending, 1)
+}
+
+func TestSubscribeWithPending(t *testing.T) {
+	ast := assert.New(t)
+	ctx := context.Background()
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.subscribe")
+	group := testGroup(t, rdb, "stream.test.subscribe", "consumer-1")
+	stream := testStream(t, rdb, "stream.test.subscribe")
+	stream.Add(ctx, map[string]interface{}{"id": "1"})
+	msgs, err := group.Get(1)
+	ast.Nil(err)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := group.Subscribe(ctx, rstream.WithPending())
+	select {
+	case msg := <-c:
+		ast.Nil(msg.Error)
+		ast.Equal(msgs[0], msg.XMessage)
+	case <-time.After(time.Second):
+		t.Error("pending message not delivered")
+	}
+}
@@ -0,0 +1,51 @@
+package rstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lyineee/go-learn/utils/log"
+)
+
+//retention policy of a stream, trimmed approximately with "~".
+//MaxLen is used if both set, zero value keeps everything.
+type Retention struct {
+	MaxLen int64         //MAXLEN ~ MaxLen
+	MaxAge time.Duration //MINID ~ id of now - MaxAge
+}
+
+func (r Retention) minID() string {
+	return fmt.Sprintf("%d-0", time.Now().Add(-r.MaxAge).UnixNano()/int64(time.Millisecond))
+}
+
+//set trim option of XADD
+func (r Retention) apply(args *redis.XAddArgs) {
+	switch {
+	case r.MaxLen > 0:
+		args.MaxLen = r.MaxLen
+		args.Approx = true
+	case r.MaxAge > 0:
+		args.MinID = r.minID()
+		args.Approx = true
+	}
+}
+
+//trim stream with its retention policy, return number of deleted entries
+func (stream *RedisStream) Trim(ctx context.Context) (deleted int64, err error) {
+	switch {
+	case stream.retention.MaxLen > 0:
+		deleted, err = stream.client.XTrimMaxLenApprox(ctx, stream.stream, stream.retention.MaxLen, 0).Result()
+	case stream.retention.MaxAge > 0:
+		deleted, err = stream.client.XTrimMinIDApprox(ctx, stream.stream, stream.retention.minID(), 0).Result()
+	default:
+		return 0, nil
+	}
+	if err != nil {
+		stream.logger.Error("trim stream fail", log.String("stream", stream.stream), log.Error(err))
+		return
+	}
+	stream.logger.Info("trim stream", log.String("stream", stream.stream), log.Any("deleted", deleted))
+	return
+}
@@ -0,0 +1,78 @@
+package rstream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lyineee/go-learn/utils/log"
+)
+
+var defaultHandleTimeout = 30 * time.Second
+
+//run handler with concurrency goroutines, ack the message if handler return nil,
+//otherwise nack it and leave it in pending list for reclaim and dead letter
+type WorkerPool struct {
+	group       *ConsumerGroup
+	concurrency int
+	handler     Handler
+	Timeout     time.Duration //timeout of one message
+}
+
+func NewWorkerPool(group *ConsumerGroup, concurrency int, handler Handler) *WorkerPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &WorkerPool{
+		group:       group,
+		concurrency: concurrency,
+		handler:     handler,
+		Timeout:     defaultHandleTimeout,
+	}
+}
+
+//consume until ctx is done and wait for in-flight handlers
+func (pool *WorkerPool) Run(ctx context.Context, opts ...SubscribeOption) error {
+	messages := pool.group.Subscribe(ctx, opts...)
+	wg := sync.WaitGroup{}
+	for i := 0; i < pool.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range messages {
+				if msg.Error != nil {
+					continue
+				}
+				pool.process(msg)
+			}
+		}()
+	}
+	wg.Wait()
+	pool.group.logger.Info("worker pool stopped", log.String("consumer", pool.group.ConsumerID))
+	return ctx.Err()
+}
+
+//handler is not canceled on shutdown, only by Timeout
+func (pool *WorkerPool) process(msg XMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), pool.Timeout)
+	err := pool.handle(ctx, msg)
+	cancel()
+	ctxAck, cancelAck := context.WithTimeout(context.Background(), 5*time.Second) //handler may use up the timeout
+	defer cancelAck()
+	if err != nil {
+		pool.group.logger.Error("handle message fail", log.String("message_id", msg.ID), log.Error(err))
+		pool.group.Nack(ctxAck, msg.ID, err)
+		return
+	}
+	pool.group.Ack(ctxAck, msg.ID)
+}
+
+func (pool *WorkerPool) handle(ctx context.Context, msg XMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return pool.handler(ctx, msg)
+}
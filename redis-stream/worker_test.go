@@ -0,0 +1,50 @@
+package rstream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	rstream "github.com/lyineee/go-learn/redis-stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPool(t *testing.T) {
+	ast := assert.New(t)
+	rdb := testClient(t)
+	resetStream(t, rdb, "stream.test.pool")
+	group := testGroup(t, rdb, "stream.test.pool", "consumer-1")
+	stream := testStream(t, rdb, "stream.test.pool")
+	for _, id := range []string{"ok", "fail", "panic"} {
+		stream.Add(context.Background(), map[string]interface{}{"id": id})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mu := sync.Mutex{}
+	handled := map[string]bool{}
+	pool := rstream.NewWorkerPool(&group, 3, func(ctx context.Context, msg rstream.XMessage) error {
+		id := msg.Values["id"].(string)
+		mu.Lock()
+		handled[id] = true
+		if len(handled) == 3 {
+			cancel()
+		}
+		mu.Unlock()
+		switch id {
+		case "fail":
+			return errors.New("handle fail")
+		case "panic":
+			panic("bad message")
+		}
+		return nil
+	})
+	err := pool.Run(ctx, rstream.WithBlock(100*time.Millisecond))
+	ast.Equal(context.Canceled, err)
+	ast.Len(handled, 3)
+
+	pending, err := group.Pending(context.Background(), "", 10)
+	ast.Nil(err)
+	ast.Len(pending, 2) //fail and panic are left pending
+}
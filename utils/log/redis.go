@@ -2,6 +2,7 @@ package log
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -11,6 +12,8 @@ type RedisWriter struct {
 	client *redis.Client
 	stream string
 	label  string
+	maxLen int64
+	maxAge time.Duration
 }
 
 func NewRedisWriter(rdb *redis.Client, stream, label string) *RedisWriter {
@@ -29,12 +32,27 @@ func NewRedisWriterWithAddress(address, password, stream, label string) *RedisWr
 	return NewRedisWriter(rdb, stream, label)
 }
 
+//trim the log stream approximately on every write, maxLen is used if both set, 0 means no limit
+func (w *RedisWriter) SetRetention(maxLen int64, maxAge time.Duration) {
+	w.maxLen = maxLen
+	w.maxAge = maxAge
+}
+
 func (w *RedisWriter) Write(p []byte) (int, error) {
 	contextTimeout, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
-	_, err := w.client.XAdd(contextTimeout, &redis.XAddArgs{
+	args := &redis.XAddArgs{
 		Stream: w.stream,
 		Values: map[string]string{w.label: string(p)},
-	}).Result()
+	}
+	switch {
+	case w.maxLen > 0:
+		args.MaxLen = w.maxLen
+		args.Approx = true
+	case w.maxAge > 0:
+		args.MinID = fmt.Sprintf("%d-0", time.Now().Add(-w.maxAge).UnixNano()/int64(time.Millisecond))
+		args.Approx = true
+	}
+	_, err := w.client.XAdd(contextTimeout, args).Result()
 	return len(p), err
 }